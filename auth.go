@@ -0,0 +1,225 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnauthorized is returned for requests without valid credentials.
+	ErrUnauthorized = &Error{Code: -32001, Message: "Unauthorized"}
+	// ErrForbidden is returned when the principal lacks the scopes required by the method.
+	ErrForbidden = &Error{Code: -32003, Message: "Forbidden"}
+
+	// ErrNoCredentials is returned by the authenticators when the request has no credentials.
+	ErrNoCredentials = errors.New("jsonrpc: no credentials")
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	Scopes  []string
+	Claims  map[string]interface{}
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// Authenticator identifies the caller of an HTTP request. body is the request body, after
+// decompression, and must not be retained. The principal is shared by all the requests
+// of a batch.
+type Authenticator interface {
+	Authenticate(r *http.Request, body []byte) (*Principal, error)
+}
+
+// AuthenticatorFunc is an adapter to allow the use of ordinary functions as Authenticators.
+type AuthenticatorFunc func(r *http.Request, body []byte) (*Principal, error)
+
+// Authenticate calls f(r, body).
+func (f AuthenticatorFunc) Authenticate(r *http.Request, body []byte) (*Principal, error) {
+	return f(r, body)
+}
+
+// WithAuthenticator authenticates the requests with a. Methods then reject callers that
+// are not authenticated with ErrUnauthorized, unless they are registered with WithAnonymous.
+func WithAuthenticator(a Authenticator) ServerOption {
+	return func(s *Server) {
+		s.authenticator = a
+	}
+}
+
+// WithScopes requires the caller of the method to be granted all the scopes, other
+// callers get ErrForbidden.
+func WithScopes(scopes ...string) MethodOption {
+	return func(h *handlerType) {
+		h.scopes = append(h.scopes, scopes...)
+	}
+}
+
+// WithAnonymous allows callers that are not authenticated to call the method.
+func WithAnonymous() MethodOption {
+	return func(h *handlerType) {
+		h.anonymous = true
+	}
+}
+
+type principalKey struct{}
+
+// authResult is the outcome of the authentication of an HTTP request.
+type authResult struct {
+	principal *Principal
+	err       error
+}
+
+// PrincipalFromContext returns the principal authenticated by the Authenticator of the Server.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	auth, ok := ctx.Value(principalKey{}).(*authResult)
+	if !ok || auth.principal == nil {
+		return nil, false
+	}
+	return auth.principal, true
+}
+
+// ContextWithPrincipal returns a copy of ctx carrying the principal p. Pass it to
+// Server.ServeConn for connections authenticated by the caller, for instance with TLS
+// client certificates.
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, &authResult{principal: p})
+}
+
+// authenticate runs the authenticator of the server and stores the result in the context.
+func (s *Server) authenticate(ctx context.Context, r *http.Request, body []byte) context.Context {
+	if s.authenticator == nil {
+		return ctx
+	}
+	principal, err := s.authenticator.Authenticate(r, body)
+	if err == nil && principal == nil {
+		err = ErrNoCredentials
+	}
+	return context.WithValue(ctx, principalKey{}, &authResult{principal: principal, err: err})
+}
+
+// authorize checks that the caller of the request can call the method.
+func (s *Server) authorize(ctx context.Context, info *RequestInfo, htype *handlerType) error {
+	auth, ok := ctx.Value(principalKey{}).(*authResult)
+	if !ok || htype.anonymous {
+		return nil
+	}
+	if auth.err != nil {
+		s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: unauthorized", requestAttrs(info, slog.Any("error", auth.err))...)
+		return ErrUnauthorized
+	}
+	for _, scope := range htype.scopes {
+		if !auth.principal.HasScope(scope) {
+			s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: forbidden", requestAttrs(info, slog.String("subject", auth.principal.Subject), slog.String("scope", scope))...)
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+// TokenValidator validates a bearer token and returns its principal.
+type TokenValidator func(ctx context.Context, token string) (*Principal, error)
+
+// BearerAuthenticator authenticates requests with the token of their
+// "Authorization: Bearer <token>" header.
+type BearerAuthenticator struct {
+	Validate TokenValidator
+}
+
+// Authenticate implements Authenticator.
+func (a BearerAuthenticator) Authenticate(r *http.Request, body []byte) (*Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrNoCredentials
+	}
+	return a.Validate(r.Context(), strings.TrimSpace(token))
+}
+
+// BearerToken returns a ClientInterceptor that sends token in the Authorization header.
+func BearerToken(token string) ClientInterceptor {
+	return func(ctx context.Context, info *RequestInfo, next ClientInvoker) (*Response, error) {
+		info.Header.Set("Authorization", "Bearer "+token)
+		return next(ctx, info)
+	}
+}
+
+// JWTValidator validates JSON Web Tokens signed with HMAC-SHA256 (HS256) and secret.
+// The subject is the "sub" claim and the scopes are read from the "scope" claim, a space
+// separated list, or from the "scp" claim. Expired tokens are rejected.
+func JWTValidator(secret []byte) TokenValidator {
+	return func(ctx context.Context, token string) (*Principal, error) {
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			return nil, errors.New("jsonrpc: malformed token")
+		}
+		var header struct {
+			Alg string `json:"alg"`
+		}
+		if err := decodeSegment(parts[0], &header); err != nil {
+			return nil, err
+		}
+		if header.Alg != "HS256" {
+			return nil, fmt.Errorf("jsonrpc: unsupported token algorithm %q", header.Alg)
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, errors.New("jsonrpc: malformed token signature")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errors.New("jsonrpc: invalid token signature")
+		}
+
+		var claims map[string]interface{}
+		if err := decodeSegment(parts[1], &claims); err != nil {
+			return nil, err
+		}
+		now := float64(time.Now().Unix())
+		if exp, ok := claims["exp"].(float64); ok && now >= exp {
+			return nil, errors.New("jsonrpc: token expired")
+		}
+		if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+			return nil, errors.New("jsonrpc: token not valid yet")
+		}
+		p := &Principal{Claims: claims}
+		p.Subject, _ = claims["sub"].(string)
+		if scope, ok := claims["scope"].(string); ok {
+			p.Scopes = strings.Fields(scope)
+		}
+		switch scp := claims["scp"].(type) {
+		case string:
+			p.Scopes = append(p.Scopes, strings.Fields(scp)...)
+		case []interface{}:
+			for _, s := range scp {
+				if s, ok := s.(string); ok {
+					p.Scopes = append(p.Scopes, s)
+				}
+			}
+		}
+		return p, nil
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("jsonrpc: malformed token")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.New("jsonrpc: malformed token")
+	}
+	return nil
+}
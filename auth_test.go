@@ -0,0 +1,140 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, secret []byte, claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	b, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newAuthServer(a Authenticator) *Server {
+	server := NewServer(WithAuthenticator(a))
+	whoami := func(ctx context.Context) (string, error) {
+		p, ok := PrincipalFromContext(ctx)
+		if !ok {
+			return "anonymous", nil
+		}
+		return p.Subject, nil
+	}
+	server.HandleFunc("whoami", whoami)
+	server.HandleFunc("admin", whoami, WithScopes("admin"))
+	server.HandleFunc("public", whoami, WithAnonymous())
+	return server
+}
+
+func TestBearerAuth(t *testing.T) {
+	secret := []byte("secret")
+	server := newAuthServer(BearerAuthenticator{Validate: JWTValidator(secret)})
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	testcases := []struct {
+		name   string
+		method string
+		token  string
+		resp   string
+	}{
+		{
+			name:   "valid",
+			method: "whoami",
+			token:  signJWT(t, secret, map[string]interface{}{"sub": "alice", "exp": exp}),
+			resp:   `{"jsonrpc":"2.0","id":1,"result":"alice"}`,
+		},
+		{
+			name:   "no_credentials",
+			method: "whoami",
+			resp:   `{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"Unauthorized"}}`,
+		},
+		{
+			name:   "invalid_signature",
+			method: "whoami",
+			token:  signJWT(t, []byte("other"), map[string]interface{}{"sub": "alice", "exp": exp}),
+			resp:   `{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"Unauthorized"}}`,
+		},
+		{
+			name:   "expired",
+			method: "whoami",
+			token:  signJWT(t, secret, map[string]interface{}{"sub": "alice", "exp": float64(time.Now().Add(-time.Hour).Unix())}),
+			resp:   `{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"Unauthorized"}}`,
+		},
+		{
+			name:   "scope",
+			method: "admin",
+			token:  signJWT(t, secret, map[string]interface{}{"sub": "alice", "scope": "read admin"}),
+			resp:   `{"jsonrpc":"2.0","id":1,"result":"alice"}`,
+		},
+		{
+			name:   "scp",
+			method: "admin",
+			token:  signJWT(t, secret, map[string]interface{}{"sub": "alice", "scp": []string{"admin"}}),
+			resp:   `{"jsonrpc":"2.0","id":1,"result":"alice"}`,
+		},
+		{
+			name:   "missing_scope",
+			method: "admin",
+			token:  signJWT(t, secret, map[string]interface{}{"sub": "bob", "scope": "read"}),
+			resp:   `{"jsonrpc":"2.0","id":1,"error":{"code":-32003,"message":"Forbidden"}}`,
+		},
+		{
+			name:   "anonymous",
+			method: "public",
+			resp:   `{"jsonrpc":"2.0","id":1,"result":"anonymous"}`,
+		},
+		{
+			name:   "anonymous_authenticated",
+			method: "public",
+			token:  signJWT(t, secret, map[string]interface{}{"sub": "alice"}),
+			resp:   `{"jsonrpc":"2.0","id":1,"result":"alice"}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"jsonrpc":"2.0","id":1,"method":"` + tc.method + `"}`
+			req := httptest.NewRequest("POST", "localhost:8080", strings.NewReader(body))
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+			if got := rw.Body.String(); got != tc.resp {
+				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, tc.resp)
+			}
+		})
+	}
+}
+
+func TestBearerTokenClient(t *testing.T) {
+	secret := []byte("secret")
+	ts := httptest.NewServer(newAuthServer(BearerAuthenticator{Validate: JWTValidator(secret)}))
+	defer ts.Close()
+	token := signJWT(t, secret, map[string]interface{}{"sub": "alice"})
+	client := NewClient(ts.URL, WithClientInterceptor(BearerToken(token)))
+
+	resp, err := client.Call(context.Background(), "whoami", nil)
+	if err != nil {
+		t.Fatalf("whoami: error not expected: %v", err)
+	}
+	var subject string
+	if err := resp.Decode(&subject); err != nil {
+		t.Fatalf("whoami: error not expected: %v", err)
+	}
+	if subject != "alice" {
+		t.Errorf("whoami: expected alice, got %v", subject)
+	}
+}
@@ -0,0 +1,312 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoAvailableEndpoint is returned by a Client when the circuit breakers of all its endpoints are open.
+var ErrNoAvailableEndpoint = errors.New("jsonrpc: no available endpoint")
+
+// Balancing is the strategy used by a Client to pick the endpoint of each request.
+type Balancing int
+
+const (
+	// RoundRobin sends the requests to each endpoint in turn.
+	RoundRobin Balancing = iota
+	// LeastInFlight sends the request to the endpoint with the fewest requests in progress.
+	LeastInFlight
+	// ConsistentHash sends all the requests of a method to the same endpoint.
+	ConsistentHash
+)
+
+// virtualNodes is the number of points of each endpoint in the consistent hash ring.
+const virtualNodes = 64
+
+// CircuitBreaker configures the circuit breaker of each endpoint. After FailureThreshold
+// consecutive failures, transport errors or HTTP 5xx and 429 responses, the endpoint is
+// skipped for OpenTimeout. Then up to HalfOpenRequests trial requests are let through,
+// the breaker closes again once all of them succeeded and reopens as soon as one fails.
+// Only the requests sent in the current state count: a request sent before the breaker
+// opened doesn't close or reopen it when it completes.
+type CircuitBreaker struct {
+	FailureThreshold int // values below 1 mean 1
+	OpenTimeout      time.Duration
+	HalfOpenRequests int // values below 1 mean 1
+}
+
+// halfOpenRequests returns the number of trials of a half-open breaker.
+func (b *CircuitBreaker) halfOpenRequests() int {
+	if b.HalfOpenRequests < 1 {
+		return 1
+	}
+	return b.HalfOpenRequests
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "BreakerState(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// WithEndpoints adds replicas of the server to the Client, the requests are spread
+// between them and the URL given to NewClient following the balancing strategy.
+func WithEndpoints(urls ...string) ClientOption {
+	return func(c *Client) {
+		for _, url := range urls {
+			c.endpoints = append(c.endpoints, &endpoint{url: url})
+		}
+	}
+}
+
+// WithBalancing sets the strategy used to pick the endpoint of each request, the default is RoundRobin.
+func WithBalancing(balancing Balancing) ClientOption {
+	return func(c *Client) {
+		c.balancing = balancing
+	}
+}
+
+// WithCircuitBreaker enables a circuit breaker on each endpoint of the Client.
+func WithCircuitBreaker(breaker CircuitBreaker) ClientOption {
+	return func(c *Client) {
+		c.breaker = &breaker
+	}
+}
+
+// EndpointState returns the state of the circuit breaker of the endpoint with the given URL.
+func (c *Client) EndpointState(url string) BreakerState {
+	for _, ep := range c.endpoints {
+		if ep.url == url {
+			ep.mu.Lock()
+			defer ep.mu.Unlock()
+			return ep.state
+		}
+	}
+	return BreakerClosed
+}
+
+type endpoint struct {
+	url      string
+	inFlight int64
+
+	mu         sync.Mutex
+	state      BreakerState
+	generation uint64    // incremented on every state change, see lease
+	failures   int       // consecutive failures while closed
+	openUntil  time.Time // end of the open state
+	trials     int       // requests let through while half-open
+	successes  int       // trials that succeeded
+}
+
+type ringPoint struct {
+	hash uint32
+	ep   *endpoint
+}
+
+// initBalancer builds the consistent hash ring once the endpoints are known.
+func (c *Client) initBalancer() {
+	if c.balancing != ConsistentHash {
+		return
+	}
+	for _, ep := range c.endpoints {
+		for i := 0; i < virtualNodes; i++ {
+			c.ring = append(c.ring, ringPoint{hash: hash32(ep.url + "#" + strconv.Itoa(i)), ep: ep})
+		}
+	}
+	sort.Slice(c.ring, func(i, j int) bool {
+		return c.ring[i].hash < c.ring[j].hash
+	})
+}
+
+// lease is a request in flight to an endpoint, see pickEndpoint. It records the state of
+// the breaker when the request was sent, the result of the request is ignored by the
+// breaker once it changed state.
+type lease struct {
+	ep         *endpoint
+	state      BreakerState
+	generation uint64
+}
+
+// pickEndpoint returns the endpoint for the next request of method and marks it as in flight.
+// The caller must report the result of the request with release.
+func (c *Client) pickEndpoint(method string) (*lease, error) {
+	n := len(c.endpoints)
+	if n == 1 && c.breaker == nil {
+		atomic.AddInt64(&c.endpoints[0].inFlight, 1)
+		return &lease{ep: c.endpoints[0]}, nil
+	}
+
+	var picked *endpoint
+	switch c.balancing {
+	case LeastInFlight:
+		for _, ep := range c.endpoints {
+			if (picked == nil || atomic.LoadInt64(&ep.inFlight) < atomic.LoadInt64(&picked.inFlight)) && c.available(ep) {
+				picked = ep
+			}
+		}
+	case ConsistentHash:
+		h := hash32(method)
+		start := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= h })
+		for i := 0; i < len(c.ring) && picked == nil; i++ {
+			if p := c.ring[(start+i)%len(c.ring)]; c.available(p.ep) {
+				picked = p.ep
+			}
+		}
+	default:
+		start := int(atomic.AddUint64(&c.nextEndpoint, 1) - 1)
+		for i := 0; i < n && picked == nil; i++ {
+			if ep := c.endpoints[(start+i)%n]; c.available(ep) {
+				picked = ep
+			}
+		}
+	}
+	if picked == nil {
+		return nil, ErrNoAvailableEndpoint
+	}
+	l := &lease{ep: picked}
+	if !c.admit(picked, l) {
+		return nil, ErrNoAvailableEndpoint
+	}
+	atomic.AddInt64(&picked.inFlight, 1)
+	return l, nil
+}
+
+// available reports whether the breaker of ep lets a request through.
+func (c *Client) available(ep *endpoint) bool {
+	return c.admit(ep, nil)
+}
+
+// admit reports whether the breaker of ep lets a request through. If l isn't nil, the
+// request is recorded, as a trial when the breaker is half-open, and l gets the state
+// of the breaker.
+func (c *Client) admit(ep *endpoint, l *lease) bool {
+	if c.breaker == nil {
+		return true
+	}
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.state == BreakerOpen && !time.Now().Before(ep.openUntil) {
+		ep.setState(BreakerHalfOpen)
+	}
+	switch ep.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if ep.trials >= c.breaker.halfOpenRequests() {
+			return false
+		}
+		if l != nil {
+			ep.trials++
+		}
+	}
+	if l != nil {
+		l.state, l.generation = ep.state, ep.generation
+	}
+	return true
+}
+
+// requestResult is the outcome of a request as seen by the circuit breaker.
+type requestResult int
+
+const (
+	requestSucceeded requestResult = iota
+	requestFailed
+	requestCanceled // canceled by the caller, it says nothing about the endpoint health
+)
+
+// resultOf classifies the result of a request sent to an endpoint.
+func resultOf(ctx context.Context, status int, err error) requestResult {
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return requestCanceled
+	case err != nil || isUnavailableStatus(status):
+		return requestFailed
+	default:
+		return requestSucceeded
+	}
+}
+
+// isUnavailableStatus reports whether the HTTP status tells that the server can't handle the request right now.
+func isUnavailableStatus(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// release records the result of a request, it is no longer in flight.
+func (c *Client) release(l *lease, result requestResult) {
+	ep := l.ep
+	atomic.AddInt64(&ep.inFlight, -1)
+	if c.breaker == nil {
+		return
+	}
+	failed := result == requestFailed
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if l.generation != ep.generation {
+		// The breaker changed state since the request was sent.
+		return
+	}
+	switch {
+	case result == requestCanceled:
+		// A canceled trial gives its place back, so the breaker isn't stuck half-open.
+		if l.state == BreakerHalfOpen {
+			ep.trials--
+		}
+	case failed && l.state == BreakerHalfOpen:
+		ep.open(c.breaker.OpenTimeout)
+	case failed:
+		ep.failures++
+		if ep.failures >= c.breaker.FailureThreshold {
+			ep.open(c.breaker.OpenTimeout)
+		}
+	case l.state == BreakerHalfOpen:
+		ep.successes++
+		if ep.successes >= c.breaker.halfOpenRequests() {
+			ep.setState(BreakerClosed)
+		}
+	default:
+		ep.failures = 0
+	}
+}
+
+func (ep *endpoint) open(timeout time.Duration) {
+	ep.setState(BreakerOpen)
+	ep.openUntil = time.Now().Add(timeout)
+}
+
+// setState moves the breaker to state and resets its counters.
+func (ep *endpoint) setState(state BreakerState) {
+	ep.state = state
+	ep.generation++
+	ep.failures, ep.trials, ep.successes = 0, 0, 0
+}
+
+func hash32(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
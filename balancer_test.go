@@ -0,0 +1,288 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type replica struct {
+	*httptest.Server
+	requests int64
+	down     int32 // the replica answers 503 when set
+}
+
+func startReplicas(t *testing.T, n int, handler http.Handler) []*replica {
+	replicas := make([]*replica, n)
+	for i := range replicas {
+		r := &replica{}
+		r.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt64(&r.requests, 1)
+			if atomic.LoadInt32(&r.down) == 1 {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			handler.ServeHTTP(rw, req)
+		}))
+		t.Cleanup(r.Close)
+		replicas[i] = r
+	}
+	return replicas
+}
+
+func newReplicaClient(replicas []*replica, opts ...ClientOption) *Client {
+	var urls []string
+	for _, r := range replicas[1:] {
+		urls = append(urls, r.URL)
+	}
+	return NewClient(replicas[0].URL, append([]ClientOption{WithEndpoints(urls...)}, opts...)...)
+}
+
+func TestRoundRobin(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	replicas := startReplicas(t, 3, server)
+	client := newReplicaClient(replicas)
+
+	for i := 0; i < 9; i++ {
+		if _, err := client.Call(context.Background(), "sum", Args{1, 2}); err != nil {
+			t.Fatalf("sum: error not expected: %v", err)
+		}
+	}
+	for i, r := range replicas {
+		if r.requests != 3 {
+			t.Errorf("replica %v: invalid number of requests:\ngot: %v\nwant: 3", i, r.requests)
+		}
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	server.HandleFunc("random", random)
+	replicas := startReplicas(t, 3, server)
+	client := newReplicaClient(replicas, WithBalancing(ConsistentHash))
+
+	for _, method := range []string{"sum", "random"} {
+		for _, r := range replicas {
+			atomic.StoreInt64(&r.requests, 0)
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := client.Call(context.Background(), method, Args{1, 2}); err != nil {
+				t.Fatalf("%v: error not expected: %v", method, err)
+			}
+		}
+		served := 0
+		for _, r := range replicas {
+			if r.requests > 0 {
+				served++
+			}
+		}
+		if served != 1 {
+			t.Errorf("%v: requests spread over %v replicas, want 1", method, served)
+		}
+	}
+}
+
+func TestLeastInFlight(t *testing.T) {
+	release := make(chan struct{})
+	server := NewServer()
+	server.HandleFunc("block", func(ctx context.Context) (int, error) {
+		<-release
+		return 0, nil
+	})
+	server.HandleFunc("sum", sum)
+	replicas := startReplicas(t, 2, server)
+	client := newReplicaClient(replicas, WithBalancing(LeastInFlight))
+
+	// Keep the first replica busy.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client.Call(context.Background(), "block", nil)
+	}()
+	for atomic.LoadInt64(&client.endpoints[0].inFlight) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Call(context.Background(), "sum", Args{1, 2}); err != nil {
+			t.Fatalf("sum: error not expected: %v", err)
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if replicas[0].requests != 1 || replicas[1].requests != 3 {
+		t.Errorf("invalid distribution:\ngot: %v %v\nwant: 1 3", replicas[0].requests, replicas[1].requests)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	replicas := startReplicas(t, 2, server)
+	atomic.StoreInt32(&replicas[0].down, 1)
+	client := newReplicaClient(replicas, WithCircuitBreaker(CircuitBreaker{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		HalfOpenRequests: 1,
+	}))
+	call := func() {
+		client.Call(context.Background(), "sum", Args{1, 2})
+	}
+
+	// Round robin alternates between replicas until the first one trips its breaker.
+	for i := 0; i < 10; i++ {
+		call()
+	}
+	if state := client.EndpointState(replicas[0].URL); state != BreakerOpen {
+		t.Fatalf("invalid breaker state: got %v, want open", state)
+	}
+	if replicas[0].requests != 2 {
+		t.Errorf("requests sent to an open endpoint:\ngot: %v\nwant: 2", replicas[0].requests)
+	}
+
+	// After the timeout a failed trial reopens the breaker.
+	time.Sleep(60 * time.Millisecond)
+	call()
+	call()
+	if state := client.EndpointState(replicas[0].URL); state != BreakerOpen {
+		t.Errorf("invalid breaker state after failed trial: got %v, want open", state)
+	}
+
+	// A successful trial closes it.
+	atomic.StoreInt32(&replicas[0].down, 0)
+	time.Sleep(60 * time.Millisecond)
+	call()
+	call()
+	if state := client.EndpointState(replicas[0].URL); state != BreakerClosed {
+		t.Errorf("invalid breaker state after successful trial: got %v, want closed", state)
+	}
+}
+
+func TestBreakerLeases(t *testing.T) {
+	client := NewClient("http://localhost:1", WithCircuitBreaker(CircuitBreaker{
+		FailureThreshold: 1,
+		OpenTimeout:      10 * time.Millisecond,
+		HalfOpenRequests: 2,
+	}))
+	url := "http://localhost:1"
+	pick := func() *lease {
+		l, err := client.pickEndpoint("sum")
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+		return l
+	}
+
+	stale := pick()
+	client.release(pick(), requestFailed)
+	time.Sleep(20 * time.Millisecond)
+	trials := []*lease{pick(), pick()}
+	if _, err := client.pickEndpoint("sum"); !errors.Is(err, ErrNoAvailableEndpoint) {
+		t.Errorf("expected the trials to be exhausted, got %v", err)
+	}
+
+	// A request sent while the breaker was closed doesn't reopen it.
+	client.release(stale, requestFailed)
+	if state := client.EndpointState(url); state != BreakerHalfOpen {
+		t.Errorf("invalid breaker state after a stale failure: got %v, want half-open", state)
+	}
+	// The breaker closes once all the trials succeeded.
+	client.release(trials[0], requestSucceeded)
+	if state := client.EndpointState(url); state != BreakerHalfOpen {
+		t.Errorf("invalid breaker state after the first trial: got %v, want half-open", state)
+	}
+	client.release(trials[1], requestSucceeded)
+	if state := client.EndpointState(url); state != BreakerClosed {
+		t.Errorf("invalid breaker state after the trials: got %v, want closed", state)
+	}
+}
+
+func TestBreakerDefaultTrials(t *testing.T) {
+	client := NewClient("http://localhost:1", WithCircuitBreaker(CircuitBreaker{OpenTimeout: 10 * time.Millisecond}))
+	l, err := client.pickEndpoint("sum")
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	client.release(l, requestFailed)
+	time.Sleep(20 * time.Millisecond)
+
+	// Without HalfOpenRequests a single trial is let through.
+	if _, err := client.pickEndpoint("sum"); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if _, err := client.pickEndpoint("sum"); !errors.Is(err, ErrNoAvailableEndpoint) {
+		t.Errorf("expected a single trial, got %v", err)
+	}
+}
+
+func TestNoAvailableEndpoint(t *testing.T) {
+	replicas := startReplicas(t, 2, NewServer())
+	for _, r := range replicas {
+		atomic.StoreInt32(&r.down, 1)
+	}
+	client := newReplicaClient(replicas, WithCircuitBreaker(CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Hour}))
+
+	for i := 0; i < 2; i++ {
+		client.Call(context.Background(), "sum", Args{1, 2})
+	}
+	_, err := client.Call(context.Background(), "sum", Args{1, 2})
+	if !errors.Is(err, ErrNoAvailableEndpoint) {
+		t.Errorf("expected ErrNoAvailableEndpoint, got %v", err)
+	}
+}
+
+func TestCanceledTrial(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	replicas := startReplicas(t, 1, server)
+	atomic.StoreInt32(&replicas[0].down, 1)
+	client := newReplicaClient(replicas, WithCircuitBreaker(CircuitBreaker{
+		FailureThreshold: 1,
+		OpenTimeout:      10 * time.Millisecond,
+		HalfOpenRequests: 1,
+	}))
+	client.Call(context.Background(), "sum", Args{1, 2})
+	atomic.StoreInt32(&replicas[0].down, 0)
+	time.Sleep(20 * time.Millisecond)
+
+	// The canceled trial doesn't use up the trials of the half-open breaker.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Call(ctx, "sum", Args{1, 2}); err == nil {
+		t.Fatalf("expected the canceled call to fail")
+	}
+	if _, err := client.Call(context.Background(), "sum", Args{1, 2}); err != nil {
+		t.Fatalf("error not expected after a canceled trial: %v", err)
+	}
+	if state := client.EndpointState(replicas[0].URL); state != BreakerClosed {
+		t.Errorf("invalid breaker state: got %v, want closed", state)
+	}
+}
+
+func TestInFlightUntilRead(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	replicas := startReplicas(t, 2, server)
+	client := newReplicaClient(replicas, WithBalancing(LeastInFlight))
+
+	hres, err := client.send(context.Background(), newRequest(1, "sum", []byte(`{"A":1,"B":2}`), nil))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if n := atomic.LoadInt64(&client.endpoints[0].inFlight); n != 1 {
+		t.Errorf("request not in flight before its response is read: %v", n)
+	}
+	hres.Body.Close()
+	if n := atomic.LoadInt64(&client.endpoints[0].inFlight); n != 0 {
+		t.Errorf("request in flight after its response is read: %v", n)
+	}
+}
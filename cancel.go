@@ -0,0 +1,152 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRequestCancelled answers the requests canceled by the client with $/cancelRequest.
+var ErrRequestCancelled = &Error{Code: -32800, Message: "Request cancelled"}
+
+// cancelMethod is the notification sent by a client to cancel one of its requests, as in
+// the Language Server Protocol: {"method":"$/cancelRequest","params":{"id":1}}.
+const cancelMethod = "$/cancelRequest"
+
+// errRequestCancelled is the cause of the contexts canceled with $/cancelRequest.
+var errRequestCancelled = errors.New("jsonrpc: request cancelled by the client")
+
+type cancelParams struct {
+	ID interface{} `json:"id"`
+}
+
+// cancelRequest is the handler of the built-in $/cancelRequest method. Only the requests
+// received on a connection can be canceled, over HTTP the client closes the request instead.
+func (s *Server) cancelRequest(ctx context.Context, params Params) (interface{}, error) {
+	var p cancelParams
+	if err := params.Decode(&p); err != nil {
+		return nil, err
+	}
+	if msg, ok := ctx.Value(connKey{}).(*connMessage); ok {
+		msg.conn.cancel(p.ID)
+	}
+	return nil, nil
+}
+
+// track returns the context of a request received on a connection, canceled when the
+// client cancels the request. done must be called once the request is answered.
+func (s *Server) track(ctx context.Context, req *request) (context.Context, func()) {
+	msg, ok := ctx.Value(connKey{}).(*connMessage)
+	if !ok || req.isNotification {
+		return ctx, func() {}
+	}
+	c, key := msg.conn, callKey(req.ID)
+	ctx, cancel := context.WithCancelCause(ctx)
+	c.mu.Lock()
+	r := msg.claim(key)
+	if r == nil {
+		// the id wasn't found by register, the request is tracked from now on
+		r = &inflightRequest{key: key}
+		c.inflight[key] = append(c.inflight[key], r)
+		msg.inflight = append(msg.inflight, r)
+	}
+	r.cancel = cancel
+	if r.cancelled {
+		cancel(errRequestCancelled)
+	}
+	c.mu.Unlock()
+	return ctx, func() { cancel(nil) }
+}
+
+// inflightRequest is a request of a connection being executed.
+type inflightRequest struct {
+	key       string
+	cancel    context.CancelCauseFunc // set once the request is executed
+	cancelled bool
+}
+
+// claim returns the first registered request of the message with key that isn't executed
+// yet, each request of a batch reusing an id gets its own. It must be called with the
+// mutex of the connection held.
+func (msg *connMessage) claim(key string) *inflightRequest {
+	for _, r := range msg.inflight {
+		if r.key == key && r.cancel == nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// register adds the requests of a message to the in-flight requests before the message
+// is executed, so a $/cancelRequest read right after it isn't missed. The requests must
+// be unregistered once the message is answered. Requests reusing the id of a request in
+// flight are added next to it, a $/cancelRequest cancels all of them. cancels reports
+// whether the message only holds $/cancelRequest calls.
+func (c *serverConn) register(data []byte) (reqs []*inflightRequest, cancels bool) {
+	// invalid messages are reported when they are executed
+	var ids []messageID
+	if isBatch(data) {
+		c.server.codec.Unmarshal(data, &ids)
+	} else {
+		ids = make([]messageID, 1)
+		c.server.codec.Unmarshal(data, &ids[0])
+	}
+	cancels = len(ids) > 0
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		cancels = cancels && id.Method == cancelMethod
+		if id.ID != nil {
+			r := &inflightRequest{key: callKey(id.ID)}
+			c.inflight[r.key] = append(c.inflight[r.key], r)
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs, cancels
+}
+
+// messageID decodes the id and the method of a request without its params.
+type messageID struct {
+	ID     interface{} `json:"id"`
+	Method string      `json:"method"`
+}
+
+// unregister removes the requests of a message from the in-flight requests.
+func (c *serverConn) unregister(msg *connMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range msg.inflight {
+		reqs := c.inflight[r.key]
+		for i := range reqs {
+			if reqs[i] == r {
+				reqs = append(reqs[:i:i], reqs[i+1:]...)
+				break
+			}
+		}
+		if len(reqs) == 0 {
+			delete(c.inflight, r.key)
+		} else {
+			c.inflight[r.key] = reqs
+		}
+	}
+}
+
+// cancel cancels the context of the requests with id that are still executing.
+func (c *serverConn) cancel(id interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.inflight[callKey(id)] {
+		r.cancelled = true
+		if r.cancel != nil {
+			r.cancel(errRequestCancelled)
+		}
+	}
+}
+
+// cancel tells the server to stop executing the request with id, its response is ignored.
+func (cc *clientConn) cancel(id interface{}) {
+	p, err := cc.client.codec.Marshal(cancelParams{ID: id})
+	if err != nil {
+		return
+	}
+	cc.send(&request{Method: cancelMethod, Params: p})
+}
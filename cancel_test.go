@@ -0,0 +1,133 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCancelServer returns a server whose "block" method waits for its context to be
+// canceled and sends the cause on causes.
+func newCancelServer(causes chan<- error) *Server {
+	server := NewServer()
+	server.HandleFunc("block", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+		return 0, ctx.Err()
+	})
+	return server
+}
+
+func TestCancelRequest(t *testing.T) {
+	causes := make(chan error, 1)
+	conn := serveConn(t, context.Background(), newCancelServer(causes))
+	r := bufio.NewReader(conn)
+	msgs := `{"jsonrpc":"2.0","id":1,"method":"block"}` + "\n" +
+		`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":2}}` + "\n" +
+		`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":1}}` + "\n"
+	if _, err := conn.Write([]byte(msgs)); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if want := `{"jsonrpc":"2.0","id":1,"error":{"code":-32800,"message":"Request cancelled"}}` + "\n"; resp != want {
+		t.Errorf("invalid response: \ngot:  %v\nwant: %v", resp, want)
+	}
+	if cause := <-causes; cause != errRequestCancelled {
+		t.Errorf("expected cause %v, got %v", errRequestCancelled, cause)
+	}
+}
+
+func TestCancelRequestIDs(t *testing.T) {
+	testcases := []struct {
+		name      string
+		requests  []string
+		cancel    string
+		responses []string
+	}{
+		{
+			name:      "string_id",
+			requests:  []string{`{"jsonrpc":"2.0","id":1,"method":"block"}`, `{"jsonrpc":"2.0","id":"1","method":"block"}`},
+			cancel:    `{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":"1"}}`,
+			responses: []string{`{"jsonrpc":"2.0","id":"1","error":{"code":-32800,"message":"Request cancelled"}}`},
+		},
+		{
+			name:      "large_id",
+			requests:  []string{`{"jsonrpc":"2.0","id":1000000,"method":"block"}`},
+			cancel:    `{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":1000000}}`,
+			responses: []string{`{"jsonrpc":"2.0","id":1000000,"error":{"code":-32800,"message":"Request cancelled"}}`},
+		},
+		{
+			name:     "reused_id",
+			requests: []string{`{"jsonrpc":"2.0","id":5,"method":"block"}`, `{"jsonrpc":"2.0","id":5,"method":"block"}`},
+			cancel:   `{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":5}}`,
+			responses: []string{
+				`{"jsonrpc":"2.0","id":5,"error":{"code":-32800,"message":"Request cancelled"}}`,
+				`{"jsonrpc":"2.0","id":5,"error":{"code":-32800,"message":"Request cancelled"}}`,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			causes := make(chan error, len(tc.requests))
+			conn := serveConn(t, context.Background(), newCancelServer(causes))
+			r := bufio.NewReader(conn)
+			if _, err := conn.Write([]byte(strings.Join(tc.requests, "\n") + "\n")); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			// the requests are executing when they are canceled
+			time.Sleep(10 * time.Millisecond)
+			if _, err := conn.Write([]byte(tc.cancel + "\n")); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for _, want := range tc.responses {
+				resp, err := r.ReadString('\n')
+				if err != nil {
+					t.Fatalf("error not expected: %v", err)
+				}
+				if resp != want+"\n" {
+					t.Errorf("invalid response: \ngot:  %v\nwant: %v", resp, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCancelRequestClient(t *testing.T) {
+	causes := make(chan error, 1)
+	client := NewConnClient(serveConn(t, context.Background(), newCancelServer(causes)))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.Call(ctx, "block", nil); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	select {
+	case cause := <-causes:
+		if cause != errRequestCancelled {
+			t.Errorf("expected cause %v, got %v", errRequestCancelled, cause)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("request not canceled on the server")
+	}
+}
+
+func TestCancelRequestHTTP(t *testing.T) {
+	server := newCancelServer(nil)
+	req := httptest.NewRequest("POST", "localhost:8080", strings.NewReader(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":1}}`))
+	rw := httptest.NewRecorder()
+	server.ServeHTTP(rw, req)
+	if rw.Body.Len() != 0 {
+		t.Errorf("expected empty body, got %v", rw.Body.String())
+	}
+}
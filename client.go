@@ -3,115 +3,457 @@ package jsonrpc
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"reflect"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Client represents a JSON-RPC Client.
 type Client struct {
 	next       int64
-	url        string
 	httpClient httpClient
+	codec      Codec
+	errorTypes map[int]func(*clientError) error
+	retry      *RetryPolicy
+	notifier   *notifier
+	conn       *clientConn // set by NewConnClient
+
+	interceptors []ClientInterceptor
+	metrics      MetricsRecorder
+	logger       *slog.Logger
+	signer       *hmacSigner
+
+	maxResponseSize int64
+	compressor      Compressor
+	compressMinSize int
+	decompressors   []Compressor
+
+	endpoints    []*endpoint
+	balancing    Balancing
+	breaker      *CircuitBreaker
+	nextEndpoint uint64
+	ring         []ringPoint
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithClientCodec sets the JSON engine used by the Client, the default is DefaultCodec.
+func WithClientCodec(codec Codec) ClientOption {
+	return func(c *Client) {
+		c.codec = codec
+	}
 }
 
 type httpClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
-var errClientContextCanceled = errors.New("context canceled by the client")
+// ErrResponseTooLarge is returned when the body of a response exceeds the limit set with WithMaxResponseSize.
+var ErrResponseTooLarge = errors.New("jsonrpc: response too large")
+
+// DefaultMaxResponseSize is the default limit of the size of a response body.
+const DefaultMaxResponseSize = 32 << 20
+
+// maxHTTPErrorBody is the number of bytes of the body kept in an HTTPError.
+const maxHTTPErrorBody = 512
+
+// HTTPError is returned when the server answers with a non-2xx status and a body
+// that isn't JSON, typically an error page of a proxy or gateway.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte // first bytes of the body, truncated to 512 bytes
+}
+
+// Error returns the string representation of the error.
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("jsonrpc: http %v %v", e.StatusCode, http.StatusText(e.StatusCode))
+	if len(e.Body) > 0 {
+		msg += ": " + string(e.Body)
+	}
+	return msg
+}
+
+func newHTTPError(hres *http.Response) *HTTPError {
+	body, _ := io.ReadAll(io.LimitReader(hres.Body, maxHTTPErrorBody))
+	return &HTTPError{StatusCode: hres.StatusCode, Header: hres.Header, Body: body}
+}
+
+func isSuccessStatus(status int) bool {
+	return status >= 200 && status < 300
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// WithMaxResponseSize limits the size of the response bodies read by the Client, the default is DefaultMaxResponseSize.
+func WithMaxResponseSize(n int64) ClientOption {
+	return func(c *Client) {
+		c.maxResponseSize = n
+	}
+}
 
 // NewClient returns a new Client to handle requests to a JSON-RPC server.
 // TODO: support custom httpClients
-func NewClient(url string) *Client {
-	return &Client{url: url, httpClient: http.DefaultClient}
+func NewClient(url string, opts ...ClientOption) *Client {
+	c := &Client{
+		httpClient:      http.DefaultClient,
+		codec:           DefaultCodec,
+		endpoints:       []*endpoint{{url: url}},
+		maxResponseSize: DefaultMaxResponseSize,
+		decompressors:   []Compressor{Gzip, Deflate},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.initBalancer()
+	if c.notifier != nil {
+		c.notifier.start(c)
+	}
+	return c
+}
+
+// WithErrorType maps the JSON-RPC errors with the given code to the Go error type E,
+// which is built from the Data of the error. Client.Call returns these errors along with
+// the response, as do Response.Err and Response.Decode, and they can be inspected with
+// errors.As while still matching the original *Error with errors.Is. E must be a
+// concrete type, WithErrorType panics if it is an interface.
+func WithErrorType[E error](code int) ClientOption {
+	etype := reflect.TypeOf((*E)(nil)).Elem()
+	if etype.Kind() == reflect.Interface {
+		panic(fmt.Sprintf("jsonrpc: WithErrorType: %v is an interface, expected a concrete error type", etype))
+	}
+	return func(c *Client) {
+		if c.errorTypes == nil {
+			c.errorTypes = map[int]func(*clientError) error{}
+		}
+		c.errorTypes[code] = func(rpcErr *clientError) error {
+			var typed reflect.Value
+			if etype.Kind() == reflect.Ptr {
+				typed = reflect.New(etype.Elem())
+				if err := rpcErr.DecodeData(typed.Interface()); err != nil && err != errNoErrorData {
+					return rpcErr
+				}
+			} else {
+				ptr := reflect.New(etype)
+				if err := rpcErr.DecodeData(ptr.Interface()); err != nil && err != errNoErrorData {
+					return rpcErr
+				}
+				typed = ptr.Elem()
+			}
+			return &typedError{typed: typed.Interface().(error), rpc: rpcErr}
+		}
+	}
+}
+
+// typedError is an error mapped by WithErrorType. errors.As finds the typed error
+// and errors.Is matches the JSON-RPC error it was built from.
+type typedError struct {
+	typed error
+	rpc   *clientError
+}
+
+func (e *typedError) Error() string {
+	return e.typed.Error()
+}
+
+func (e *typedError) Unwrap() error {
+	return e.rpc
+}
+
+func (e *typedError) As(target interface{}) bool {
+	return errors.As(e.typed, target)
 }
 
 // Call executes the named method, waits for it to complete, and returns a JSONRPC response.
-func (c *Client) Call(ctx context.Context, method string, params interface{}) (*Response, error) {
-	done := make(chan error)
+// The JSON-RPC errors are returned in the response, see Response.Err, except those mapped
+// to a Go type with WithErrorType which are also returned as the error.
+func (c *Client) Call(ctx context.Context, method string, params interface{}, opts ...CallOption) (*Response, error) {
+	p, err := c.codec.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("jsonrpc: marshaling params: %w", err)
+	}
+	return c.doCall(ctx, newRequest(c.nextID(), method, p, opts))
+}
+
+func newRequest(id interface{}, method string, params []byte, opts []CallOption) *request {
+	req := &request{ID: id, Method: method, Params: params}
+	for _, opt := range opts {
+		opt(req)
+	}
+	if req.onProgress != nil {
+		req.progressToken = id
+	}
+	return req
+}
+
+func (c *Client) doCall(ctx context.Context, req *request) (*Response, error) {
+	resp, err := c.intercept(ctx, req, c.doCallNext)
+	if err == nil && resp != nil && resp.error != nil {
+		if _, ok := c.errorTypes[resp.error.Code]; ok {
+			return resp, resp.Err()
+		}
+	}
+	return resp, err
+}
+
+func (c *Client) doCallNext(ctx context.Context, req *request) (*Response, error) {
 	resp := &Response{}
-	go c.call(ctx, method, params, resp, done)
-	select {
-	case <-ctx.Done():
-		return nil, fmt.Errorf("jsonrpc: %v", ctx.Err())
-	case err := <-done:
+	var start time.Time
+	if c.metrics != nil {
+		c.metrics.RequestStarted(req.Method)
+		start = time.Now()
+	}
+	err := c.call(ctx, req, resp)
+	if c.metrics != nil {
+		c.record(req, start, resp, err)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("jsonrpc: %v", ctxErr)
+		}
 		return resp, err
 	}
+	return resp, nil
 }
 
-// Notify executes the named method and discards the response.
+// Notify executes the named method and discards the response. With WithAsyncNotify
+// the notification is queued and sent in the background, see WithAsyncNotify.
 func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
-	done := make(chan error)
-	go c.notify(ctx, method, params, done)
-	select {
-	case <-ctx.Done():
-		return fmt.Errorf("jsonrpc: %v", ctx.Err())
-	case err := <-done:
-		return err
+	p, err := c.codec.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("jsonrpc: marshaling params: %w", err)
 	}
+	req := &request{ID: nil, Method: method, Params: p}
+	_, err = c.intercept(ctx, req, c.notifyNext)
+	return err
 }
 
-func (c *Client) notify(ctx context.Context, method string, params interface{}, done chan error) {
-	p, err := json.Marshal(params)
-	if err != nil {
-		done <- fmt.Errorf("jsonrpc: marshaling params: %w", err)
-		return
+func (c *Client) notifyNext(ctx context.Context, req *request) (*Response, error) {
+	if c.notifier != nil {
+		return nil, c.notifier.enqueue(req)
+	}
+	var start time.Time
+	if c.metrics != nil {
+		c.metrics.RequestStarted(req.Method)
+		start = time.Now()
+	}
+	err := c.notify(ctx, req)
+	if c.metrics != nil {
+		c.record(req, start, nil, err)
 	}
-	req := &request{ID: nil, Method: method, Params: p}
-	rc, err := c.send(ctx, req)
 	if err != nil {
-		done <- fmt.Errorf("jsonrpc: sending request: %w", err)
-		return
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("jsonrpc: %v", ctxErr)
+		}
+		return nil, err
 	}
-	defer rc.Close()
+	return nil, nil
+}
 
-	done <- nil
+// record reports the outcome of req to the metrics recorder, resp is nil for notifications.
+func (c *Client) record(req *request, start time.Time, resp *Response, err error) {
+	m := RequestMetrics{Method: req.Method, Notification: resp == nil, Err: err, Duration: time.Since(start), RequestSize: req.size}
+	if resp != nil {
+		m.ResponseSize = resp.size
+		if err == nil && resp.error != nil {
+			m.Code = resp.error.Code
+		}
+	}
+	c.metrics.RequestFinished(m)
 }
 
-func (c *Client) call(ctx context.Context, method string, params interface{}, resp *Response, done chan error) {
-	p, err := json.Marshal(params)
+// notify sends the notifications in reqs, as a batch when there is more than one.
+func (c *Client) notify(ctx context.Context, reqs ...*request) error {
+	if c.conn != nil {
+		if err := c.conn.send(reqs...); err != nil {
+			return fmt.Errorf("jsonrpc: sending request: %w", err)
+		}
+		return nil
+	}
+	hres, err := c.send(ctx, reqs...)
 	if err != nil {
-		done <- fmt.Errorf("jsonrpc: marshaling params: %w", err)
-		return
+		return fmt.Errorf("jsonrpc: sending request: %w", err)
+	}
+	defer hres.Body.Close()
+
+	if !isSuccessStatus(hres.StatusCode) {
+		return newHTTPError(hres)
 	}
-	req := &request{ID: c.nextID(), Method: method, Params: p}
-	rc, err := c.send(ctx, req)
+	return nil
+}
+
+func (c *Client) call(ctx context.Context, req *request, resp *Response) error {
+	method := req.Method
+	for attempt := 1; ; attempt++ {
+		status, err := c.roundTrip(ctx, req, resp)
+		if !c.retry.shouldRetry(ctx, method, attempt, status, resp, err) {
+			return err
+		}
+		cause := err
+		if cause == nil {
+			cause = resp.error
+		}
+		c.log().LogAttrs(ctx, slog.LevelDebug, "jsonrpc: retrying", slog.String("method", method), slog.Int("attempt", attempt), slog.Any("error", cause))
+		if err := c.retry.wait(ctx, method, attempt, err); err != nil {
+			return err
+		}
+	}
+}
+
+// roundTrip sends req and decodes the response into resp, it returns the HTTP status of the response.
+func (c *Client) roundTrip(ctx context.Context, req *request, resp *Response) (int, error) {
+	*resp = Response{}
+	if c.conn != nil {
+		if err := c.conn.call(ctx, req, resp); err != nil {
+			return 0, err
+		}
+		resp.errorTypes = c.errorTypes
+		return 0, nil
+	}
+	hres, err := c.send(ctx, req)
 	if err != nil {
-		done <- fmt.Errorf("jsonrpc: sending request: %w", err)
-		return
+		return 0, fmt.Errorf("jsonrpc: sending request: %w", err)
 	}
-	defer rc.Close()
+	defer hres.Body.Close()
 
-	if err := decodeResponseFromReader(rc, resp); err != nil {
-		done <- fmt.Errorf("jsonrpc: reading response: %w", err)
-		return
+	// Servers may answer JSON-RPC errors with a non-2xx status, anything else is an HTTP error.
+	if !isSuccessStatus(hres.StatusCode) && !isJSONContentType(hres.Header.Get("Content-Type")) {
+		return hres.StatusCode, newHTTPError(hres)
+	}
+	if isEventStream(hres.Header.Get("Content-Type")) {
+		if err := c.readStream(hres.Body, req, resp); err != nil {
+			return hres.StatusCode, err
+		}
+		resp.errorTypes = c.errorTypes
+		return hres.StatusCode, nil
 	}
 
-	done <- nil
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(io.LimitReader(hres.Body, c.maxResponseSize+1)); err != nil {
+		return hres.StatusCode, fmt.Errorf("jsonrpc: reading response: %w", err)
+	}
+	if int64(buf.Len()) > c.maxResponseSize {
+		return hres.StatusCode, ErrResponseTooLarge
+	}
+	if err := decodeResponse(c.codec, buf.Bytes(), resp); err != nil {
+		return hres.StatusCode, fmt.Errorf("jsonrpc: reading response: %w", err)
+	}
+	resp.errorTypes = c.errorTypes
+	resp.size = buf.Len()
+	return hres.StatusCode, nil
 }
 
-// send sends data from r to the http server and returns a reader of the response
-func (c *Client) send(ctx context.Context, req *request) (io.ReadCloser, error) {
-	b, err := req.bytes()
+// send sends reqs to the http server and returns its response, the caller must close the body.
+// More than one request is sent as a batch.
+func (c *Client) send(ctx context.Context, reqs ...*request) (*http.Response, error) {
+	buf := getBuffer()
+	if err := encodeRequests(c.codec, buf, reqs); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	if len(reqs) == 1 {
+		reqs[0].size = buf.Len()
+	}
+	var signature http.Header
+	if c.signer != nil {
+		signature = http.Header{}
+		if err := c.signer.sign(signature, buf.Bytes()); err != nil {
+			putBuffer(buf)
+			return nil, err
+		}
+	}
+	encoding := ""
+	if c.compressor != nil && buf.Len() >= c.compressMinSize {
+		zbuf := getBuffer()
+		err := compress(c.compressor, zbuf, buf.Bytes())
+		putBuffer(buf)
+		if err != nil {
+			putBuffer(zbuf)
+			return nil, err
+		}
+		buf, encoding = zbuf, c.compressor.Name()
+	}
+	l, err := c.pickEndpoint(reqs[0].Method)
 	if err != nil {
+		putBuffer(buf)
 		return nil, err
 	}
-	hreq, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBuffer(b))
+	// The transport may read the body after Do returns, on redirects or from another
+	// goroutine, so it gets its own copy and the pooled buffer is released now.
+	body := bytes.Clone(buf.Bytes())
+	putBuffer(buf)
+	hreq, err := http.NewRequestWithContext(ctx, "POST", l.ep.url, bytes.NewReader(body))
 	if err != nil {
+		c.release(l, requestCanceled)
 		return nil, err
 	}
+	for k, v := range reqs[0].header {
+		hreq.Header[k] = v
+	}
+	for k, v := range signature {
+		hreq.Header[k] = v
+	}
 	hreq.Header.Set("Content-Type", "application/json")
 	hreq.Header.Set("Accept", "application/json")
+	if len(reqs) == 1 && (reqs[0].onNotification != nil || reqs[0].onProgress != nil) {
+		hreq.Header.Set("Accept", "application/json, "+eventStreamType)
+	}
+	hreq.Header.Set("Accept-Encoding", acceptEncoding(c.decompressors))
+	if encoding != "" {
+		hreq.Header.Set("Content-Encoding", encoding)
+	}
 
 	hres, err := c.httpClient.Do(hreq)
+	result := resultOf(ctx, statusOf(hres), err)
 	if err != nil {
+		c.release(l, result)
 		return nil, err
 	}
-	return hres.Body, nil
+	// The request stays in flight until its response is read.
+	hres.Body = &releasedBody{ReadCloser: hres.Body, release: func() { c.release(l, result) }}
+	if encoding := hres.Header.Get("Content-Encoding"); encoding != "" {
+		decoded, err := decompressBody(c.decompressors, encoding, hres.Body)
+		if err != nil {
+			hres.Body.Close()
+			return nil, err
+		}
+		hres.Body = &compressed{ReadCloser: decoded, body: hres.Body}
+		hres.Header.Del("Content-Encoding")
+	}
+	return hres, nil
+}
+
+func statusOf(hres *http.Response) int {
+	if hres == nil {
+		return 0
+	}
+	return hres.StatusCode
+}
+
+// releasedBody is a response body that releases its endpoint when it is closed.
+type releasedBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
 }
 
 // nextID returns the next id using atomic operations
@@ -3,7 +3,13 @@ package jsonrpc
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -39,13 +45,9 @@ func (s *state) increaseCounter(ctx context.Context, add int) (int, error) {
 	return s.N, nil
 }
 
-var port = ":4545"
-
 func TestCallSync(t *testing.T) {
 	counter := &state{}
-	go startServer(t, counter)
-
-	client := NewClient("http://localhost" + port)
+	client := NewClient(startServer(t, counter))
 
 	// Some valid calls
 	sum := &Reply{}
@@ -101,8 +103,10 @@ func TestCallSync(t *testing.T) {
 }
 
 func BenchmarkClientSync(b *testing.B) {
+	url := startServer(b, &state{})
 	b.Run("call", func(b *testing.B) {
-		client := NewClient("http://localhost" + port)
+		client := NewClient(url)
+		b.ReportAllocs()
 		for i := 0; i < b.N; i++ {
 			var reply int
 			resp, err := client.Call(context.Background(), "counter", 6)
@@ -115,7 +119,8 @@ func BenchmarkClientSync(b *testing.B) {
 		}
 	})
 	b.Run("notify", func(b *testing.B) {
-		client := NewClient("http://localhost" + port)
+		client := NewClient(url)
+		b.ReportAllocs()
 		for i := 0; i < b.N; i++ {
 			err := client.Notify(context.Background(), "counter", 6)
 			if err != nil {
@@ -125,13 +130,193 @@ func BenchmarkClientSync(b *testing.B) {
 	})
 }
 
-func startServer(t *testing.T, counter *state) {
+// startServer serves the test methods over HTTP until the end of the test and returns its URL.
+func startServer(t testing.TB, counter *state) string {
 	s := NewServer()
 	s.HandleFunc("sum", sum)
 	s.HandleFunc("random", random)
 	s.HandleFunc("counter", counter.increaseCounter)
 
-	if err := http.ListenAndServe(port, s); err != nil {
-		t.Errorf("starting server: %v", err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go http.Serve(l, s)
+	return "http://" + l.Addr().String()
+}
+
+type NotFoundError struct {
+	Resource string `json:"resource"`
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " not found"
+}
+
+func TestClientErrorData(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("get", func(ctx context.Context, id string) (string, error) {
+		return "", errNotFound.New(NotFoundData{Resource: id})
+	})
+	server.HandleFunc("fail", func(ctx context.Context) (string, error) {
+		return "", &Error{Code: 1, Message: "Failure", Data: []int{1, 2}}
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithErrorType[*NotFoundError](404))
+	resp, err := client.Call(context.Background(), "get", "user")
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || notFound.Resource != "user" {
+		t.Errorf("get: invalid typed error:\ngot: %#v\nwant: *NotFoundError", err)
+	}
+	if !errNotFound.Is(err) {
+		t.Errorf("get: typed error doesn't wrap the JSON-RPC error")
+	}
+	var reply string
+	if err := resp.Decode(&reply); !errors.As(err, &notFound) {
+		t.Errorf("get: decode: invalid typed error:\ngot: %#v\nwant: *NotFoundError", err)
+	}
+
+	resp, err = client.Call(context.Background(), "fail", nil)
+	if err != nil {
+		t.Fatalf("fail: error not expected: %v", err)
+	}
+	var rpcErr *Error
+	if !errors.As(resp.Err(), &rpcErr) {
+		t.Fatalf("fail: expected *Error, got %v", resp.Err())
+	}
+	var data []int
+	if err := rpcErr.DecodeData(&data); err != nil || len(data) != 2 || data[1] != 2 {
+		t.Errorf("fail: invalid data:\ngot: %v %v\nwant: [1 2]", data, err)
+	}
+}
+
+func TestErrorTypeInterface(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected WithErrorType to panic with an interface type")
+		}
+	}()
+	WithErrorType[error](1)
+}
+
+func TestClientHTTPError(t *testing.T) {
+	var status int
+	var contentType, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", contentType)
+		rw.WriteHeader(status)
+		rw.Write([]byte(body))
+	}))
+	defer ts.Close()
+	client := NewClient(ts.URL, WithMaxResponseSize(128))
+
+	// Gateway error page.
+	status, contentType, body = http.StatusBadGateway, "text/html", "<html>"+strings.Repeat("x", 1024)+"</html>"
+	_, err := client.Call(context.Background(), "sum", Args{1, 2})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected *HTTPError, got %v", err)
+	}
+	if httpErr.StatusCode != http.StatusBadGateway || httpErr.Header.Get("Content-Type") != "text/html" || len(httpErr.Body) != 512 {
+		t.Errorf("invalid http error: %v %v %v", httpErr.StatusCode, httpErr.Header, len(httpErr.Body))
+	}
+	if err := client.Notify(context.Background(), "sum", Args{1, 2}); !errors.As(err, &httpErr) {
+		t.Errorf("notify: expected *HTTPError, got %v", err)
+	}
+
+	// JSON-RPC error sent with an error status.
+	status, contentType, body = http.StatusInternalServerError, "application/json; charset=utf-8", `{"jsonrpc":"2.0","id":3,"error":{"code":-32603,"message":"Internal error"}}`
+	resp, err := client.Call(context.Background(), "sum", Args{1, 2})
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if !errors.Is(resp.Err(), ErrInternalError) {
+		t.Errorf("expected ErrInternalError, got %v", resp.Err())
+	}
+
+	// Response larger than the limit.
+	status, contentType, body = http.StatusOK, "application/json", `{"jsonrpc":"2.0","id":4,"result":"`+strings.Repeat("x", 128)+`"}`
+	_, err = client.Call(context.Background(), "sum", Args{1, 2})
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("expected ErrResponseTooLarge, got %v", err)
+	}
+}
+
+// checkGoroutineLeaks fails the test if goroutines running client or server code
+// of this package are still alive once the test ends.
+func checkGoroutineLeaks(t *testing.T) {
+	t.Cleanup(func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			leaked := leakedGoroutines()
+			if len(leaked) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Errorf("%v leaked goroutines, first one:\n%v", len(leaked), leaked[0])
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func leakedGoroutines() []string {
+	buf := make([]byte, 8<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	var leaked []string
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, "jsonrpc.(*Client)") || strings.Contains(g, "jsonrpc.(*notifier)") || strings.Contains(g, "jsonrpc.(*Server)") ||
+			strings.Contains(g, "jsonrpc.(*clientConn)") || strings.Contains(g, "jsonrpc.(*ClientSubscription)") {
+			leaked = append(leaked, g)
+		}
+	}
+	return leaked
+}
+
+func TestCancelNoLeak(t *testing.T) {
+	checkGoroutineLeaks(t)
+
+	server := NewServer()
+	server.HandleFunc("block", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+
+	const calls, concurrency = 2000, 100
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var failed int64
+	for i := 0; i < calls; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(1+i%5)*time.Millisecond)
+			defer cancel()
+
+			var err error
+			if i%2 == 0 {
+				_, err = client.Call(ctx, "block", nil)
+			} else {
+				err = client.Notify(ctx, "block", nil)
+			}
+			if err == nil {
+				atomic.AddInt64(&failed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if failed > 0 {
+		t.Errorf("%v canceled calls returned without error", failed)
 	}
 }
@@ -0,0 +1,26 @@
+// Package example is a JSON-RPC service used to exercise the code generated by jsonrpc-gen.
+package example
+
+import (
+	"context"
+	"time"
+)
+
+//go:generate go run ../..
+
+// User is returned by UserService.
+type User struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// UserService manages users.
+//
+//jsonrpc:service user.
+type UserService interface {
+	//jsonrpc:method getById
+	Get(ctx context.Context, id string) (*User, error)
+	Rename(ctx context.Context, u User) (User, error)
+	Count(ctx context.Context) (int, error)
+}
@@ -0,0 +1,108 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/echovl/jsonrpc"
+)
+
+type users struct {
+	byID map[string]*User
+}
+
+func (u *users) Get(ctx context.Context, id string) (*User, error) {
+	user, ok := u.byID[id]
+	if !ok {
+		return nil, &jsonrpc.Error{Code: 404, Message: "User not found"}
+	}
+	return user, nil
+}
+
+func (u *users) Rename(ctx context.Context, user User) (User, error) {
+	u.byID[user.ID].Name = user.Name
+	return *u.byID[user.ID], nil
+}
+
+func (u *users) Count(ctx context.Context) (int, error) {
+	return len(u.byID), nil
+}
+
+func TestGeneratedService(t *testing.T) {
+	server := jsonrpc.NewServer()
+	RegisterUserService(server, &users{byID: map[string]*User{"1": {ID: "1", Name: "Jhon Doe"}}})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client := NewUserServiceClient(jsonrpc.NewClient(ts.URL))
+	ctx := context.Background()
+
+	user, err := client.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("get: error not expected: %v", err)
+	}
+	if user.Name != "Jhon Doe" {
+		t.Errorf("get: invalid name: expected Jhon Doe, got %v", user.Name)
+	}
+
+	renamed, err := client.Rename(ctx, User{ID: "1", Name: "Jane Doe"})
+	if err != nil {
+		t.Fatalf("rename: error not expected: %v", err)
+	}
+	if renamed.Name != "Jane Doe" {
+		t.Errorf("rename: invalid name: expected Jane Doe, got %v", renamed.Name)
+	}
+
+	n, err := client.Count(ctx)
+	if err != nil {
+		t.Fatalf("count: error not expected: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("count: expected 1, got %v", n)
+	}
+
+	_, err = client.Get(ctx, "2")
+	var rpcErr *jsonrpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != 404 {
+		t.Errorf("get unknown user:\ngot: %v\nwant: code 404", err)
+	}
+
+	_, err = client.Get(ctx, "")
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc.ErrInvalidParams.Code {
+		t.Errorf("get empty id:\ngot: %v\nwant: ErrInvalidParams", err)
+	}
+}
+
+func TestGeneratedServiceDiscovery(t *testing.T) {
+	server := jsonrpc.NewServer()
+	RegisterUserService(server, &users{})
+
+	testcases := []struct {
+		method string
+		params int
+	}{
+		{method: "user.getById", params: 1},
+		{method: "user.Rename", params: 3}, // the fields of User
+		{method: "user.Count", params: 0},
+	}
+	methods := map[string]jsonrpc.OpenRPCMethod{}
+	for _, m := range server.OpenRPC().Methods {
+		methods[m.Name] = m
+	}
+	for _, tc := range testcases {
+		t.Run(tc.method, func(t *testing.T) {
+			m, ok := methods[tc.method]
+			if !ok {
+				t.Fatalf("method not documented")
+			}
+			if len(m.Params) != tc.params {
+				t.Errorf("expected %v params, got %v", tc.params, len(m.Params))
+			}
+			if m.Result == nil || m.Result.Schema == nil {
+				t.Errorf("expected a result schema, got %+v", m.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+// Command jsonrpc-gen generates reflection-free JSON-RPC server adapters and
+// typed client stubs from annotated Go interfaces.
+//
+// An interface is selected with a "jsonrpc:service" comment, optionally followed
+// by a prefix prepended to every method name. A method can override its JSON-RPC
+// name with a "jsonrpc:method" comment:
+//
+//	//go:generate jsonrpc-gen
+//
+//	//jsonrpc:service user.
+//	type UserService interface {
+//		//jsonrpc:method getById
+//		Get(ctx context.Context, id string) (User, error)
+//		Count(ctx context.Context) (int, error)
+//	}
+//
+// Methods must follow the same rules as jsonrpc.Server.HandleFunc: a context.Context,
+// an optional params argument, and a (result, error) return. For each service the
+// command emits a RegisterXxx function that plugs an implementation into a
+// jsonrpc.Server and an XxxClient type built on jsonrpc.Client.Call. The methods are
+// registered with jsonrpc.Handle, so rpc.discover describes their params and results.
+// Imported packages whose name doesn't follow their import path are resolved with
+// go list and imported with an explicit name.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	serviceAnnotation = "jsonrpc:service"
+	methodAnnotation  = "jsonrpc:method"
+	jsonrpcImportPath = "github.com/echovl/jsonrpc"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("jsonrpc-gen: ")
+
+	output := flag.String("output", "", "output file name; default <file>_jsonrpc.go")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jsonrpc-gen [-output file] [file.go]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	input := flag.Arg(0)
+	if input == "" {
+		input = os.Getenv("GOFILE")
+	}
+	if input == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(input, ".go") + "_jsonrpc.go"
+	}
+
+	src, err := os.ReadFile(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	code, err := generate(filepath.Dir(input), filepath.Base(input), src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, code, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type service struct {
+	Name    string
+	Methods []method
+}
+
+type method struct {
+	Name    string // Go method name
+	RPCName string // JSON-RPC method name
+	Params  string // params type expression, empty if the method has no params
+	Result  string // result type expression
+}
+
+// generate parses the Go source in src and returns the formatted adapters for its annotated interfaces.
+// The imports of src are resolved from dir, the directory of the source file.
+func generate(dir, filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []service
+	used := map[string]bool{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			prefix, ok := annotation(doc, serviceAnnotation)
+			if !ok {
+				continue
+			}
+			iface, ok := ts.Type.(*ast.InterfaceType)
+			if !ok {
+				return nil, fmt.Errorf("%v: %v is annotated with %v but is not an interface", fset.Position(ts.Pos()), ts.Name.Name, serviceAnnotation)
+			}
+			svc, err := parseService(fset, ts.Name.Name, prefix, iface, used)
+			if err != nil {
+				return nil, err
+			}
+			services = append(services, svc)
+		}
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("%v: no interface annotated with %v", filename, serviceAnnotation)
+	}
+
+	imports, err := collectImports(dir, file, used)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = fileTemplate.Execute(&buf, struct {
+		Package  string
+		Imports  []string
+		Services []service
+	}{file.Name.Name, imports, services})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func parseService(fset *token.FileSet, name, prefix string, iface *ast.InterfaceType, used map[string]bool) (service, error) {
+	svc := service{Name: name}
+	for _, field := range iface.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return svc, fmt.Errorf("%v: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		m := method{Name: field.Names[0].Name, RPCName: prefix + field.Names[0].Name}
+		if rpcName, ok := annotation(field.Doc, methodAnnotation); ok && rpcName != "" {
+			m.RPCName = prefix + rpcName
+		}
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%v: %v.%v: %v", fset.Position(field.Pos()), name, m.Name, fmt.Sprintf(format, args...))
+		}
+
+		params := flatten(ft.Params)
+		if len(params) != 1 && len(params) != 2 {
+			return svc, errorf("invalid number of args: expected 2, got %v", len(params))
+		}
+		if types.ExprString(params[0]) != "context.Context" {
+			return svc, errorf("invalid first arg type: expected context.Context, got %v", types.ExprString(params[0]))
+		}
+		if len(params) == 2 {
+			m.Params = types.ExprString(params[1])
+			markUsed(params[1], used)
+		}
+
+		results := flatten(ft.Results)
+		if len(results) != 2 {
+			return svc, errorf("invalid number of returns: expected 2, got %v", len(results))
+		}
+		if types.ExprString(results[1]) != "error" {
+			return svc, errorf("invalid second return type: expected error, got %v", types.ExprString(results[1]))
+		}
+		m.Result = types.ExprString(results[0])
+		markUsed(results[0], used)
+
+		svc.Methods = append(svc.Methods, m)
+	}
+	return svc, nil
+}
+
+// annotation looks for a comment line of the form "//key value" and returns value.
+func annotation(doc *ast.CommentGroup, key string) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, c := range doc.List {
+		text := strings.TrimPrefix(c.Text, "//")
+		if text == key {
+			return "", true
+		}
+		if strings.HasPrefix(text, key+" ") {
+			return strings.TrimSpace(strings.TrimPrefix(text, key)), true
+		}
+	}
+	return "", false
+}
+
+// flatten expands a field list so that "a, b int" yields one entry per name.
+func flatten(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	var exprs []ast.Expr
+	for _, f := range fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			exprs = append(exprs, f.Type)
+		}
+	}
+	return exprs
+}
+
+// markUsed records the package names referenced by a type expression.
+func markUsed(expr ast.Expr, used map[string]bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+// collectImports returns the import specs of file referenced by the generated code.
+// The name of a package is guessed from its import path, the imports that don't match
+// a referenced name are resolved with the go command and imported with an explicit name.
+func collectImports(dir string, file *ast.File, used map[string]bool) ([]string, error) {
+	imports := map[string]string{
+		"context": strconv.Quote("context"),
+		"jsonrpc": strconv.Quote(jsonrpcImportPath),
+	}
+	var unknown []string // import paths whose package name isn't known
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		name := packageName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		} else if !used[name] {
+			unknown = append(unknown, importPath)
+		}
+		if !used[name] || name == "context" || name == "jsonrpc" {
+			continue
+		}
+		if spec.Name != nil {
+			imports[name] = spec.Name.Name + " " + spec.Path.Value
+		} else {
+			imports[name] = spec.Path.Value
+		}
+	}
+	if unresolved(imports, used) != "" && len(unknown) > 0 {
+		names, err := listPackageNames(dir, unknown)
+		if err != nil {
+			return nil, err
+		}
+		for _, importPath := range unknown {
+			name := names[importPath]
+			if _, ok := imports[name]; ok || !used[name] {
+				continue
+			}
+			imports[name] = name + " " + strconv.Quote(importPath)
+		}
+	}
+	if name := unresolved(imports, used); name != "" {
+		return nil, errors.New("unresolved package " + name)
+	}
+
+	// Standard library imports go first, separated by a blank line from the rest.
+	var std, other []string
+	for _, spec := range imports {
+		importPath := spec[strings.Index(spec, `"`)+1:]
+		if strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	return append(append(std, ""), other...), nil
+}
+
+// unresolved returns a package name referenced by the generated code that has no import,
+// or "" if all of them are imported.
+func unresolved(imports map[string]string, used map[string]bool) string {
+	for name := range used {
+		if _, ok := imports[name]; !ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// listPackageNames returns the package names of importPaths, resolved by the go command
+// from dir.
+func listPackageNames(dir string, importPaths []string) (map[string]string, error) {
+	cmd := exec.Command("go", append([]string{"list", "-e", "-f", "{{.ImportPath}} {{.Name}}"}, importPaths...)...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("resolving package names: %v", err)
+	}
+	names := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if importPath, name, ok := strings.Cut(line, " "); ok && name != "" {
+			names[importPath] = name
+		}
+	}
+	return names, nil
+}
+
+// packageName guesses the package name of an import path, skipping major version
+// suffixes such as "/v2" and gopkg.in's ".v3".
+func packageName(importPath string) string {
+	name := path.Base(importPath)
+	if isMajorVersion(name) {
+		name = path.Base(path.Dir(importPath))
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 && isMajorVersion(name[i+1:]) {
+		name = name[:i]
+	}
+	return strings.TrimSuffix(name, ".go")
+}
+
+// isMajorVersion reports whether s is a major version suffix, such as "v2".
+func isMajorVersion(s string) bool {
+	return len(s) > 1 && s[0] == 'v' && strings.Trim(s[1:], "0123456789") == ""
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by jsonrpc-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range $svc := .Services}}
+// Register{{$svc.Name}} registers the methods of {{$svc.Name}} on s.
+func Register{{$svc.Name}}(s *jsonrpc.Server, impl {{$svc.Name}}) {
+{{- range .Methods}}
+	{{- if .Params}}
+	jsonrpc.Handle(s, "{{.RPCName}}", impl.{{.Name}})
+	{{- else}}
+	jsonrpc.HandleNoParams(s, "{{.RPCName}}", impl.{{.Name}})
+	{{- end}}
+{{- end}}
+}
+
+// {{$svc.Name}}Client is a typed JSON-RPC client for {{$svc.Name}}.
+type {{$svc.Name}}Client struct {
+	c *jsonrpc.Client
+}
+
+// New{{$svc.Name}}Client returns a {{$svc.Name}}Client that sends its calls through c.
+func New{{$svc.Name}}Client(c *jsonrpc.Client) *{{$svc.Name}}Client {
+	return &{{$svc.Name}}Client{c: c}
+}
+{{range .Methods}}
+// {{.Name}} calls the {{.RPCName}} method.
+func (c *{{$svc.Name}}Client) {{.Name}}(ctx context.Context{{if .Params}}, p {{.Params}}{{end}}) ({{.Result}}, error) {
+	var r {{.Result}}
+	resp, err := c.c.Call(ctx, "{{.RPCName}}", {{if .Params}}p{{else}}nil{{end}})
+	if err != nil {
+		return r, err
+	}
+	err = resp.Decode(&r)
+	return r, err
+}
+{{end}}
+{{- end}}`))
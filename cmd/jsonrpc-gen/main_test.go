@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGolden(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("internal", "example", "service.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("internal", "example", "service_jsonrpc.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generate(filepath.Join("internal", "example"), "service.go", src)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("generated code is out of date, run go generate ./...\ngot:\n%s", got)
+	}
+}
+
+var generateErrTestcases = []struct {
+	name string
+	src  string
+	err  string
+}{
+	{
+		name: "no_service",
+		src:  "package p\n\ntype S interface{}\n",
+		err:  "p.go: no interface annotated with jsonrpc:service",
+	},
+	{
+		name: "not_interface",
+		src:  "package p\n\n//jsonrpc:service\ntype S struct{}\n",
+		err:  "p.go:4:6: S is annotated with jsonrpc:service but is not an interface",
+	},
+	{
+		name: "invalid_first_arg_type",
+		src:  "package p\n\n//jsonrpc:service\ntype S interface {\n\tM(s string) (int, error)\n}\n",
+		err:  "p.go:5:2: S.M: invalid first arg type: expected context.Context, got string",
+	},
+	{
+		name: "invalid_num_returns",
+		src:  "package p\n\nimport \"context\"\n\n//jsonrpc:service\ntype S interface {\n\tM(ctx context.Context) error\n}\n",
+		err:  "p.go:7:2: S.M: invalid number of returns: expected 2, got 1",
+	},
+	{
+		name: "unresolved_package",
+		src:  "package p\n\nimport \"context\"\n\n//jsonrpc:service\ntype S interface {\n\tM(ctx context.Context) (foo.Bar, error)\n}\n",
+		err:  "unresolved package foo",
+	},
+}
+
+func TestGenerateErr(t *testing.T) {
+	for _, tc := range generateErrTestcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := generate(".", "p.go", []byte(tc.src))
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("invalid generate error:\ngot: %v\nwant: %v\n", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestGenerateImportNames(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The package names of go-bar and v2 don't match their import paths.
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":        "module example.com/m\n\ngo 1.21\n\nrequire github.com/echovl/jsonrpc v0.0.0\n\nreplace github.com/echovl/jsonrpc => " + root + "\n",
+		"go-bar/bar.go": "package bar\n\ntype Args struct{ A, B int }\n",
+		"v2/baz.go":     "package baz\n\ntype Reply struct{ C int }\n",
+		"service.go":    "package m\n\nimport (\n\t\"context\"\n\n\t\"example.com/m/go-bar\"\n\t\"example.com/m/v2\"\n)\n\n//jsonrpc:service\ntype S interface {\n\tSum(ctx context.Context, args bar.Args) (baz.Reply, error)\n}\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, err := generate(dir, "service.go", []byte(files["service.go"]))
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	for _, spec := range []string{`bar "example.com/m/go-bar"`, `baz "example.com/m/v2"`} {
+		if !strings.Contains(string(code), spec) {
+			t.Errorf("expected import %v, got:\n%s", spec, code)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "service_jsonrpc.go"), code, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("generated code doesn't build: %v\n%s", err, out)
+	}
+}
+
+func TestPackageName(t *testing.T) {
+	testcases := []struct {
+		path string
+		name string
+	}{
+		{path: "time", name: "time"},
+		{path: "net/http", name: "http"},
+		{path: "github.com/echovl/jsonrpc", name: "jsonrpc"},
+		{path: "github.com/go-chi/chi/v5", name: "chi"},
+		{path: "gopkg.in/yaml.v3", name: "yaml"},
+		{path: "github.com/nats-io/nats.go", name: "nats"},
+		{path: "example.com/v2", name: "example.com"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.path, func(t *testing.T) {
+			if got := packageName(tc.path); got != tc.name {
+				t.Errorf("expected %v, got %v", tc.name, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Codec is the JSON engine used to encode and decode JSON-RPC messages.
+// It allows replacing encoding/json with a faster implementation.
+// Unmarshal must not retain data after returning, since it is backed by a pooled buffer.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	NewEncoder(w io.Writer) Encoder
+}
+
+// Encoder writes JSON values to an output stream.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// DefaultCodec is the Codec backed by encoding/json.
+var DefaultCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder {
+	return jsonEncoder{w}
+}
+
+// jsonEncoder writes a single JSON value without the trailing newline added by json.Encoder.
+type jsonEncoder struct {
+	w io.Writer
+}
+
+func (e jsonEncoder) Encode(v interface{}) error {
+	// Encoding straight into a buffer avoids the copy made by json.Marshal.
+	if buf, ok := e.w.(*bytes.Buffer); ok {
+		n := buf.Len()
+		if err := json.NewEncoder(buf).Encode(v); err != nil {
+			buf.Truncate(n)
+			return err
+		}
+		buf.Truncate(buf.Len() - 1)
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
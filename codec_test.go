@@ -0,0 +1,139 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// countingCodec wraps DefaultCodec and counts how many times it is used.
+type countingCodec struct {
+	calls int64
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt64(&c.calls, 1)
+	return DefaultCodec.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt64(&c.calls, 1)
+	return DefaultCodec.Unmarshal(data, v)
+}
+
+func (c *countingCodec) NewEncoder(w io.Writer) Encoder {
+	atomic.AddInt64(&c.calls, 1)
+	return DefaultCodec.NewEncoder(w)
+}
+
+func TestCodec(t *testing.T) {
+	scodec, ccodec := &countingCodec{}, &countingCodec{}
+	server := NewServer(WithServerCodec(scodec))
+	server.HandleFunc("sum", sum)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithClientCodec(ccodec))
+	resp, err := client.Call(context.Background(), "sum", Args{1, 2})
+	if err != nil {
+		t.Fatalf("sum: error not expected: %v", err)
+	}
+	reply := &Reply{}
+	if err := resp.Decode(reply); err != nil {
+		t.Fatalf("sum: error not expected: %v", err)
+	}
+	if reply.C != 3 {
+		t.Errorf("sum: invalid sum: expected 3, got %v", reply.C)
+	}
+	if scodec.calls == 0 {
+		t.Errorf("server codec not used")
+	}
+	if ccodec.calls == 0 {
+		t.Errorf("client codec not used")
+	}
+}
+
+var errCodecData = NewErrorCode[[]int](1, "Fail")
+
+func TestCodecErrorData(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("fail", func(ctx context.Context) (int, error) {
+		return 0, errCodecData.New([]int{1, 2})
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	codec := &countingCodec{}
+	client := NewClient(ts.URL, WithClientCodec(codec))
+	resp, err := client.Call(context.Background(), "fail", nil)
+	if err != nil {
+		t.Fatalf("fail: error not expected: %v", err)
+	}
+	rpcErr := resp.Err()
+	if !errors.Is(rpcErr, &Error{Code: 1}) {
+		t.Fatalf("fail: expected code 1, got %v", rpcErr)
+	}
+
+	calls := atomic.LoadInt64(&codec.calls)
+	data, ok := errCodecData.Data(rpcErr)
+	if !ok || len(data) != 2 {
+		t.Errorf("fail: invalid data:\ngot: %v\nwant: [1 2]", data)
+	}
+	if atomic.LoadInt64(&codec.calls) == calls {
+		t.Errorf("error data not decoded with the client codec")
+	}
+
+	// The *Error found with errors.As decodes its data with encoding/json.
+	var e *Error
+	if !errors.As(rpcErr, &e) {
+		t.Fatalf("fail: expected *Error, got %v", rpcErr)
+	}
+	data = nil
+	if err := e.DecodeData(&data); err != nil || len(data) != 2 {
+		t.Errorf("fail: invalid data:\ngot: %v %v\nwant: [1 2]", data, err)
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	body := []byte(`{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}}`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("POST", "localhost:8080", bytes.NewReader(body))
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+	}
+}
+
+func BenchmarkServeHTTPParallel(b *testing.B) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	body := []byte(`{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}}`)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("POST", "localhost:8080", bytes.NewReader(body))
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+		}
+	})
+}
+
+func BenchmarkDecodeResponse(b *testing.B) {
+	body := []byte(`{"jsonrpc":"2.0","id":1,"result":{"text":"text","number":33,"boolean":true}}`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resp := &Response{}
+		if err := decodeResponse(DefaultCodec, body, resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
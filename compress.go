@@ -0,0 +1,194 @@
+package jsonrpc
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compressor implements an HTTP content coding used to compress request and response bodies.
+// Gzip and Deflate are built in, zstd is implemented by the jsonrpczstd module and other
+// codings can be added by implementing it.
+type Compressor interface {
+	// Name returns the content coding token, as sent in Content-Encoding and Accept-Encoding.
+	Name() string
+	NewWriter(w io.Writer) io.WriteCloser
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	// Gzip is the gzip content coding.
+	Gzip Compressor = gzipCompressor{}
+	// Deflate is the deflate content coding, the zlib format of RFC 1950.
+	Deflate Compressor = deflateCompressor{}
+)
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (gzipCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type deflateCompressor struct{}
+
+func (deflateCompressor) Name() string {
+	return "deflate"
+}
+
+func (deflateCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	return zlib.NewWriter(w)
+}
+
+func (deflateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+// errUnsupportedEncoding is returned for a Content-Encoding without a Compressor.
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// DefaultMaxRequestSize is the default limit of the size of a request body, after decompression.
+const DefaultMaxRequestSize = 32 << 20
+
+// WithServerCompression compresses the responses of at least minSize bytes with the first
+// of compressors accepted by the client, gzip and deflate when none is given. Requests
+// compressed with these codings, or with gzip and deflate, are decompressed in any case.
+func WithServerCompression(minSize int, compressors ...Compressor) ServerOption {
+	return func(s *Server) {
+		if len(compressors) == 0 {
+			compressors = []Compressor{Gzip, Deflate}
+		}
+		// The given compressors take precedence over the ones with the same name.
+		var merged []Compressor
+		for _, c := range append(append([]Compressor{}, compressors...), s.compressors...) {
+			if findCompressor(merged, c.Name()) == nil {
+				merged = append(merged, c)
+			}
+		}
+		s.compressors = merged
+		s.compressMinSize = minSize
+		s.compressResponses = true
+	}
+}
+
+// WithMaxRequestSize limits the size of the request bodies read by the Server, after
+// decompression, the default is DefaultMaxRequestSize.
+func WithMaxRequestSize(n int64) ServerOption {
+	return func(s *Server) {
+		s.maxRequestSize = n
+	}
+}
+
+// WithClientCompression compresses the request bodies of at least minSize bytes with c.
+// Responses are decompressed transparently, whether this option is set or not.
+func WithClientCompression(c Compressor, minSize int) ClientOption {
+	return func(cl *Client) {
+		cl.compressor = c
+		cl.compressMinSize = minSize
+		if findCompressor(cl.decompressors, c.Name()) == nil {
+			cl.decompressors = append([]Compressor{c}, cl.decompressors...)
+		}
+	}
+}
+
+// compress writes data compressed with c to w.
+func compress(c Compressor, w io.Writer, data []byte) error {
+	cw := c.NewWriter(w)
+	if _, err := cw.Write(data); err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// findCompressor returns the compressor of the given content coding.
+func findCompressor(compressors []Compressor, name string) Compressor {
+	for _, c := range compressors {
+		if strings.EqualFold(c.Name(), name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// decompressBody returns a reader of the decoded body for the given Content-Encoding.
+func decompressBody(compressors []Compressor, encoding string, body io.Reader) (io.ReadCloser, error) {
+	encoding = strings.TrimSpace(encoding)
+	if encoding == "" || strings.EqualFold(encoding, "identity") {
+		return io.NopCloser(body), nil
+	}
+	c := findCompressor(compressors, encoding)
+	if c == nil {
+		return nil, fmt.Errorf("%w: %v", errUnsupportedEncoding, encoding)
+	}
+	return c.NewReader(body)
+}
+
+// negotiateCompressor returns the first of compressors accepted by the Accept-Encoding
+// header, nil if none is.
+func negotiateCompressor(compressors []Compressor, header http.Header) Compressor {
+	accepted := map[string]bool{}
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			accepted[name] = quality(params) > 0
+		}
+	}
+	for _, c := range compressors {
+		name := strings.ToLower(c.Name())
+		if ok, found := accepted[name]; ok || (!found && accepted["*"]) {
+			return c
+		}
+	}
+	return nil
+}
+
+// quality returns the q parameter of a coding of Accept-Encoding, 1 when it is missing
+// and 0 when it is invalid.
+func quality(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0
+		}
+		return q
+	}
+	return 1
+}
+
+// acceptEncoding returns the Accept-Encoding header value listing compressors.
+func acceptEncoding(compressors []Compressor) string {
+	names := make([]string, len(compressors))
+	for i, c := range compressors {
+		names[i] = c.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// compressed is a decompressed response body, closing it closes the original body.
+type compressed struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (c *compressed) Close() error {
+	c.ReadCloser.Close()
+	return c.body.Close()
+}
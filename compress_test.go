@@ -0,0 +1,190 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	server := NewServer(WithServerCompression(0))
+	server.HandleFunc("echo", func(ctx context.Context, s string) (string, error) {
+		return s, nil
+	})
+	var reqEncoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		reqEncoding = r.Header.Get("Content-Encoding")
+		server.ServeHTTP(rw, r)
+	}))
+	defer ts.Close()
+
+	for _, c := range []Compressor{Gzip, Deflate} {
+		t.Run(c.Name(), func(t *testing.T) {
+			client := NewClient(ts.URL, WithClientCompression(c, 0))
+			text := strings.Repeat("text", 1000)
+			resp, err := client.Call(context.Background(), "echo", text)
+			if err != nil {
+				t.Fatalf("echo: error not expected: %v", err)
+			}
+			var got string
+			if err := resp.Decode(&got); err != nil {
+				t.Fatalf("echo: error not expected: %v", err)
+			}
+			if got != text {
+				t.Errorf("echo: invalid result of %v bytes", len(got))
+			}
+			if reqEncoding != c.Name() {
+				t.Errorf("expected request encoding %v, got %q", c.Name(), reqEncoding)
+			}
+		})
+	}
+}
+
+func TestServerCompression(t *testing.T) {
+	server := NewServer(WithServerCompression(64))
+	server.HandleFunc("text", func(ctx context.Context, n int) (string, error) {
+		return strings.Repeat("a", n), nil
+	})
+
+	testcases := []struct {
+		name           string
+		acceptEncoding string
+		size           int
+		encoding       string
+	}{
+		{name: "gzip", acceptEncoding: "gzip", size: 100, encoding: "gzip"},
+		{name: "deflate", acceptEncoding: "deflate", size: 100, encoding: "deflate"},
+		{name: "preference", acceptEncoding: "deflate, gzip", size: 100, encoding: "gzip"},
+		{name: "refused", acceptEncoding: "gzip;q=0, deflate", size: 100, encoding: "deflate"},
+		{name: "refused_decimals", acceptEncoding: "gzip; q=0.000, deflate;q=0.5", size: 100, encoding: "deflate"},
+		{name: "refused_any", acceptEncoding: "*;q=0", size: 100, encoding: ""},
+		{name: "invalid_quality", acceptEncoding: "gzip;q=high, deflate", size: 100, encoding: "deflate"},
+		{name: "any", acceptEncoding: "*", size: 100, encoding: "gzip"},
+		{name: "unknown", acceptEncoding: "br", size: 100, encoding: ""},
+		{name: "none", acceptEncoding: "", size: 100, encoding: ""},
+		{name: "small", acceptEncoding: "gzip", size: 1, encoding: ""},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"jsonrpc":"2.0","id":1,"method":"text","params":` + strconv.Itoa(tc.size) + `}`
+			req := httptest.NewRequest("POST", "localhost:8080", strings.NewReader(body))
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+
+			if got := rw.Header().Get("Content-Encoding"); got != tc.encoding {
+				t.Fatalf("expected content encoding %q, got %q", tc.encoding, got)
+			}
+			decoded, err := decompressBody([]Compressor{Gzip, Deflate}, tc.encoding, rw.Body)
+			if err != nil {
+				t.Fatalf("decompressing: %v", err)
+			}
+			data, err := io.ReadAll(decoded)
+			if err != nil {
+				t.Fatalf("decompressing: %v", err)
+			}
+			want := `{"jsonrpc":"2.0","id":1,"result":"` + strings.Repeat("a", tc.size) + `"}`
+			if string(data) != want {
+				t.Errorf("invalid jsonrpc response: \ngot: %s\nwant: %v\n", data, want)
+			}
+		})
+	}
+}
+
+func TestServerCompressors(t *testing.T) {
+	testcases := []struct {
+		name        string
+		compressors []Compressor
+		names       string
+	}{
+		{name: "default", names: "gzip, deflate"},
+		{name: "builtin", compressors: []Compressor{Deflate}, names: "deflate, gzip"},
+		{name: "repeated", compressors: []Compressor{Gzip, Gzip}, names: "gzip, deflate"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(WithServerCompression(64, tc.compressors...))
+			if got := acceptEncoding(server.compressors); got != tc.names {
+				t.Errorf("invalid compressors:\ngot: %v\nwant: %v", got, tc.names)
+			}
+		})
+	}
+}
+
+func TestServerDecompressionLimit(t *testing.T) {
+	server := NewServer(WithMaxRequestSize(1024))
+	server.HandleFunc("sum", sum)
+
+	testcases := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+	}{
+		{
+			name:     "bomb",
+			encoding: "gzip",
+			body:     gzipBytes(t, append([]byte(`{"jsonrpc":"2.0","id":1,"method":"sum","params":"`), make([]byte, 1<<20)...)),
+			status:   http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "large",
+			body:   append([]byte(`{"jsonrpc":"2.0","id":1,"method":"sum","params":"`), make([]byte, 2048)...),
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "unsupported",
+			encoding: "br",
+			body:     []byte(`{}`),
+			status:   http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "valid",
+			encoding: "gzip",
+			body:     gzipBytes(t, []byte(`{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}}`)),
+			status:   http.StatusOK,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "localhost:8080", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Encoding", tc.encoding)
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+			if rw.Code != tc.status {
+				t.Errorf("expected status %v, got %v: %v", tc.status, rw.Code, rw.Body.String())
+			}
+		})
+	}
+}
+
+func TestClientDecompressionLimit(t *testing.T) {
+	body := gzipBytes(t, append([]byte(`{"jsonrpc":"2.0","id":1,"result":"`), make([]byte, 1<<20)...))
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Encoding", "gzip")
+		rw.Write(body)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithMaxResponseSize(1024))
+	if _, err := client.Call(context.Background(), "bomb", nil); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("expected ErrResponseTooLarge, got %v", err)
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	if err := compress(Gzip, &buf, data); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
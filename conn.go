@@ -0,0 +1,583 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrConnClosed is returned by the calls of a Client whose connection is closed.
+	ErrConnClosed = errors.New("jsonrpc: connection closed")
+
+	errMessageTooLarge = errors.New("jsonrpc: message too large")
+)
+
+type connKey struct{}
+
+// DefaultMaxConnRequests is the default number of messages of a connection executed at the
+// same time.
+const DefaultMaxConnRequests = 100
+
+// WithMaxConnRequests limits the number of messages of a connection served with ServeConn
+// executed at the same time, a batch counts as one message. The default is
+// DefaultMaxConnRequests, values below 1 mean 1.
+func WithMaxConnRequests(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConnRequests = n
+	}
+}
+
+// Serve accepts connections on l and serves each of them with ServeConn, until l is
+// closed. It returns ErrServerClosed once Shutdown is called, which closes l.
+func (s *Server) Serve(l net.Listener) error {
+	s.init()
+	if !s.life.addListener(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.life.removeListener(l)
+	var delay time.Duration // how long to sleep on accept failure
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.life.shuttingDown() {
+				return ErrServerClosed
+			}
+			// Retry temporary errors, such as running out of file descriptors, with a
+			// backoff as net/http does.
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+				s.log().LogAttrs(context.Background(), slog.LevelError, "jsonrpc: accept error", slog.Any("error", err), slog.Duration("retry_in", delay))
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		go s.ServeConn(context.Background(), conn)
+	}
+}
+
+// ServeConn serves the requests received on conn until the client closes it or ctx is
+// canceled, the connection is closed on return. Messages are newline delimited JSON
+// values, requests or batches, and are executed concurrently. Over a connection the
+// server can also push notifications to the client, see HandleSubscription, and the
+// client can cancel its requests with the $/cancelRequest notification, the handlers
+// then fail with ErrRequestCancelled.
+//
+// With an Authenticator, the calls are rejected with ErrUnauthorized unless ctx carries
+// the principal of the connection, see ContextWithPrincipal.
+//
+// At most the number of messages set with WithMaxConnRequests are executed at the same
+// time, the connection isn't read until one of them is answered. Messages only holding
+// $/cancelRequest calls don't wait, so the requests in flight can still be canceled.
+//
+// Shutdown closes the connection once its requests are answered, ServeConn then returns
+// ErrServerClosed.
+func (s *Server) ServeConn(ctx context.Context, conn io.ReadWriteCloser) error {
+	s.init()
+	c := &serverConn{server: s, conn: conn, subscriptions: map[string]*Subscription{}, inflight: map[string][]*inflightRequest{}}
+	if addr, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		c.remoteAddr = addr.RemoteAddr().String()
+	}
+	// The handlers are canceled after the connection is closed, so their responses are dropped.
+	hctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	abort := func(cause error) {
+		c.close()
+		cancel(cause)
+	}
+	if !s.life.addConn(c, abort) {
+		abort(errServerShutdown)
+		return ErrServerClosed
+	}
+	defer s.life.removeConn(c)
+	stop := context.AfterFunc(ctx, func() {
+		abort(nil)
+	})
+	if s.authenticator != nil {
+		if _, ok := hctx.Value(principalKey{}).(*authResult); !ok {
+			hctx = context.WithValue(hctx, principalKey{}, &authResult{err: ErrNoCredentials})
+		}
+	}
+	var wg sync.WaitGroup
+	defer func() {
+		stop()
+		c.close()
+		cancel(nil)
+		wg.Wait()
+		c.closeSubscriptions()
+	}()
+
+	slots := make(chan struct{}, max(s.maxConnRequests, 1)) // messages being executed
+	r := bufio.NewReader(conn)
+	for {
+		data, err := readMessage(r, s.maxRequestSize)
+		if errors.Is(err, errMessageTooLarge) {
+			s.log().LogAttrs(hctx, slog.LevelWarn, "jsonrpc: request too large", remoteAttr(c.remoteAddr), slog.Int64("limit", s.maxRequestSize))
+			return err
+		}
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			if s.life.shuttingDown() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		reqs, cancels := c.register(data)
+		if cancels {
+			leave := s.life.enter()
+			c.serve(hctx, data, reqs)
+			leave()
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-hctx.Done():
+			// the connection was closed while waiting for a request to be answered
+			if s.life.shuttingDown() {
+				return ErrServerClosed
+			}
+			return nil
+		}
+		leave := s.life.enter()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer leave()
+			c.serve(hctx, data, reqs)
+		}()
+	}
+}
+
+// readMessage reads a newline delimited message of at most limit bytes.
+func readMessage(r *bufio.Reader, limit int64) ([]byte, error) {
+	var msg []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		if int64(len(msg)+len(line)) > limit+1 {
+			return nil, errMessageTooLarge
+		}
+		msg = append(msg, line...)
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(msg) > 0:
+			// the last message may not be terminated by a newline
+			return msg, nil
+		}
+		return msg, err
+	}
+}
+
+// serverConn is a connection served with ServeConn.
+type serverConn struct {
+	server     *Server
+	conn       io.ReadWriteCloser
+	remoteAddr string
+
+	wmu    sync.Mutex // serializes the writes
+	closed atomic.Bool
+
+	mu            sync.Mutex
+	subscriptions map[string]*Subscription
+	inflight      map[string][]*inflightRequest // requests being executed, by id
+}
+
+// connMessage is a message received on a connection. The subscriptions created by its
+// requests are activated once its response is written, so their notifications follow it.
+type connMessage struct {
+	conn          *serverConn
+	subscriptions []*Subscription
+	inflight      []*inflightRequest // guarded by the mutex of conn
+}
+
+// serve executes the requests of a message, registered as reqs, and writes the response.
+func (c *serverConn) serve(ctx context.Context, data []byte, reqs []*inflightRequest) {
+	msg := &connMessage{conn: c, inflight: reqs}
+	defer c.unregister(msg)
+	out := getBuffer()
+	defer putBuffer(out)
+	defer func() {
+		// Unlike net/http, nothing recovers the goroutines of a connection, a panic would
+		// take the process down.
+		if r := recover(); r != nil {
+			c.server.log().LogAttrs(ctx, slog.LevelError, "jsonrpc: panic serving message", remoteAttr(c.remoteAddr), slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
+			for _, sub := range msg.subscriptions {
+				sub.close()
+			}
+			out.Reset()
+			c.server.writeInternalErrors(out, data)
+			c.writeResponse(ctx, out)
+		}
+	}()
+	c.server.serveMessage(context.WithValue(ctx, connKey{}, msg), &peer{remoteAddr: c.remoteAddr}, out, data)
+	c.writeResponse(ctx, out)
+	for _, sub := range msg.subscriptions {
+		sub.activate()
+	}
+}
+
+// writeResponse writes the response of a message, if any, to the connection.
+func (c *serverConn) writeResponse(ctx context.Context, out *bytes.Buffer) {
+	if out.Len() == 0 {
+		return
+	}
+	out.WriteByte('\n')
+	if err := c.write(out.Bytes()); err != nil && err != ErrConnClosed {
+		c.server.log().LogAttrs(ctx, slog.LevelError, "jsonrpc: writing response", remoteAttr(c.remoteAddr), slog.Any("error", err))
+	}
+}
+
+// writeInternalErrors answers every request of a message whose execution panicked with
+// ErrInternalError, the responses already written by its other requests are lost.
+func (s *Server) writeInternalErrors(out *bytes.Buffer, data []byte) {
+	var ids []messageID
+	if isBatch(data) {
+		s.codec.Unmarshal(data, &ids)
+	} else {
+		ids = make([]messageID, 1)
+		s.codec.Unmarshal(data, &ids[0])
+	}
+	var resps []*Response
+	for _, id := range ids {
+		if id.ID != nil {
+			resps = append(resps, errResponse(id.ID, ErrInternalError))
+		}
+	}
+	switch {
+	case len(resps) == 0:
+	case isBatch(data):
+		out.WriteByte('[')
+		for i, resp := range resps {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			s.writeResponse(out, resp)
+		}
+		out.WriteByte(']')
+	default:
+		s.writeResponse(out, resps[0])
+	}
+}
+
+// notify sends a notification to the client.
+func (c *serverConn) notify(method string, params interface{}) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := c.server.codec.NewEncoder(buf).Encode(notificationMessage{Version: "2.0", Method: method, Params: params}); err != nil {
+		return fmt.Errorf("jsonrpc: encoding notification: %w", err)
+	}
+	buf.WriteByte('\n')
+	return c.write(buf.Bytes())
+}
+
+// write writes a newline terminated message to the connection.
+func (c *serverConn) write(data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed.Load() {
+		return ErrConnClosed
+	}
+	_, err := c.conn.Write(data)
+	return err
+}
+
+func (c *serverConn) close() {
+	c.closed.Store(true)
+	c.conn.Close()
+}
+
+// NewConnClient returns a Client that sends its requests over conn, a persistent
+// connection to a server served with Server.ServeConn. The calls are multiplexed on the
+// connection and the server can push notifications, see Client.Subscribe. The options
+// specific to HTTP, such as endpoints, compression, signing and the headers set by the
+// interceptors, don't apply. The calls whose context is canceled are canceled on the
+// server with a $/cancelRequest notification. Client.Close closes the connection.
+func NewConnClient(conn io.ReadWriteCloser, opts ...ClientOption) *Client {
+	cc := &clientConn{
+		conn:          conn,
+		pending:       map[string]*connCall{},
+		subscriptions: map[string]*ClientSubscription{},
+		done:          make(chan struct{}),
+	}
+	c := NewClient("", append(opts, func(c *Client) { c.conn = cc })...)
+	cc.client = c
+	go cc.run()
+	return c
+}
+
+// Dial connects to the server listening on the network address, see Server.Serve, and
+// returns a Client using the connection.
+func Dial(ctx context.Context, network, address string, opts ...ClientOption) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("jsonrpc: dialing: %w", err)
+	}
+	return NewConnClient(conn, opts...), nil
+}
+
+// clientConn is the connection of a Client created with NewConnClient.
+type clientConn struct {
+	client *Client
+	conn   io.ReadWriteCloser
+	wmu    sync.Mutex // serializes the writes
+	done   chan struct{}
+
+	mu            sync.Mutex // guards pending, subscriptions and closed
+	pending       map[string]*connCall
+	subscriptions map[string]*ClientSubscription
+	closed        bool
+}
+
+// connCall is a call waiting for its response, resp is nil if the connection was closed.
+type connCall struct {
+	done chan struct{}
+	resp *Response
+	req  *request
+}
+
+// callKey identifies the response of a request. The ids sent as integers are decoded as
+// float64 or json.Number, numbers are formatted in decimal notation so they get the same
+// key, and strings are quoted so that "1" and 1 differ.
+func callKey(id interface{}) string {
+	switch id := id.(type) {
+	case string:
+		return strconv.Quote(id)
+	case int64:
+		return strconv.FormatInt(id, 10)
+	case int:
+		return strconv.Itoa(id)
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	case json.Number:
+		if n, err := id.Int64(); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		if f, err := id.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return id.String()
+	default:
+		return fmt.Sprint(id)
+	}
+}
+
+// call sends req and waits for its response.
+func (cc *clientConn) call(ctx context.Context, req *request, resp *Response) error {
+	call := &connCall{done: make(chan struct{}), req: req}
+	key := callKey(req.ID)
+	cc.mu.Lock()
+	if cc.closed {
+		cc.mu.Unlock()
+		return ErrConnClosed
+	}
+	cc.pending[key] = call
+	cc.mu.Unlock()
+
+	if err := cc.send(req); err != nil {
+		cc.forget(key, call)
+		return fmt.Errorf("jsonrpc: sending request: %w", err)
+	}
+	select {
+	case <-call.done:
+		if call.resp == nil {
+			return ErrConnClosed
+		}
+		*resp = *call.resp
+		return nil
+	case <-ctx.Done():
+		// The response of a subscribe call is still awaited, so that a subscription
+		// accepted by the server after ctx was canceled is unsubscribed.
+		if req.subscription == nil {
+			cc.forget(key, call)
+		}
+		cc.cancel(req.ID)
+		return ctx.Err()
+	}
+}
+
+// forget stops waiting for the response of call.
+func (cc *clientConn) forget(key string, call *connCall) {
+	cc.mu.Lock()
+	if cc.pending[key] == call {
+		delete(cc.pending, key)
+	}
+	cc.mu.Unlock()
+}
+
+// send writes reqs to the connection, more than one request is sent as a batch.
+func (cc *clientConn) send(reqs ...*request) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := encodeRequests(cc.client.codec, buf, reqs); err != nil {
+		return err
+	}
+	if len(reqs) == 1 {
+		reqs[0].size = buf.Len()
+	}
+	buf.WriteByte('\n')
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	_, err := cc.conn.Write(buf.Bytes())
+	return err
+}
+
+// run reads the messages of the server until the connection is closed.
+func (cc *clientConn) run() {
+	defer close(cc.done)
+	r := bufio.NewReader(cc.conn)
+	for {
+		data, err := readMessage(r, cc.client.maxResponseSize)
+		if err != nil {
+			if err != io.EOF && !cc.isClosed() {
+				cc.client.log().LogAttrs(context.Background(), slog.LevelWarn, "jsonrpc: reading connection", slog.Any("error", err))
+			}
+			cc.close()
+			return
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		if data[0] != '[' {
+			cc.handle(data)
+			continue
+		}
+		var batch []json.RawMessage
+		if err := cc.client.codec.Unmarshal(data, &batch); err != nil {
+			cc.client.log().LogAttrs(context.Background(), slog.LevelWarn, "jsonrpc: invalid message", slog.Any("error", err))
+			continue
+		}
+		for _, data := range batch {
+			cc.handle(data)
+		}
+	}
+}
+
+// handle dispatches a response to its call, or a notification to its subscription.
+func (cc *clientConn) handle(data []byte) {
+	codec := cc.client.codec
+	msg := &rawMessage{}
+	if err := codec.Unmarshal(data, msg); err != nil {
+		cc.client.log().LogAttrs(context.Background(), slog.LevelWarn, "jsonrpc: invalid message", slog.Any("error", err))
+		return
+	}
+	if msg.Method != "" {
+		cc.notification(msg)
+		return
+	}
+
+	resp := &Response{id: msg.ID, result: msg.Result, codec: codec, size: len(data)}
+	if err := resp.setError(msg.Error); err != nil {
+		cc.client.log().LogAttrs(context.Background(), slog.LevelWarn, "jsonrpc: invalid message", slog.Any("error", err))
+		return
+	}
+	if resp.result == nil {
+		resp.result = null
+	}
+	key := callKey(msg.ID)
+	cc.mu.Lock()
+	call, ok := cc.pending[key]
+	delete(cc.pending, key)
+	// The subscription is registered before reading the next message, which may be its first notification.
+	if ok && call.req.subscription != nil && resp.error == nil {
+		sub := call.req.subscription
+		var id string
+		if err := codec.Unmarshal(resp.result, &id); err == nil && sub.ended {
+			// the subscribe call was abandoned, the reader can't wait for the unsubscribe call
+			go sub.unsubscribe(id)
+		} else if err == nil {
+			sub.id = id
+			cc.subscriptions[id] = sub
+			go sub.forward()
+		}
+	}
+	cc.mu.Unlock()
+	if !ok {
+		cc.client.log().LogAttrs(context.Background(), slog.LevelDebug, "jsonrpc: unexpected response", slog.Any("id", msg.ID))
+		return
+	}
+	call.resp = resp
+	close(call.done)
+}
+
+// notification delivers a notification sent by the server.
+func (cc *clientConn) notification(msg *rawMessage) {
+	if msg.Method == progressMethod {
+		var params struct {
+			Token interface{} `json:"token"`
+		}
+		if err := cc.client.codec.Unmarshal(msg.Params, &params); err == nil {
+			cc.mu.Lock()
+			call, ok := cc.pending[callKey(params.Token)]
+			cc.mu.Unlock()
+			if ok && call.req.progress(cc.client.codec, msg.Params) {
+				return
+			}
+		}
+	}
+	if strings.HasSuffix(msg.Method, subscriptionSuffix) {
+		var params struct {
+			ID     string          `json:"subscription"`
+			Result json.RawMessage `json:"result"`
+		}
+		if err := cc.client.codec.Unmarshal(msg.Params, &params); err == nil {
+			cc.mu.Lock()
+			sub, ok := cc.subscriptions[params.ID]
+			cc.mu.Unlock()
+			if ok {
+				sub.deliver(params.Result)
+				return
+			}
+		}
+	}
+	cc.client.log().LogAttrs(context.Background(), slog.LevelDebug, "jsonrpc: unexpected notification", slog.String("method", msg.Method))
+}
+
+func (cc *clientConn) isClosed() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.closed
+}
+
+// close closes the connection, the pending calls and the subscriptions fail with ErrConnClosed.
+func (cc *clientConn) close() {
+	cc.mu.Lock()
+	if cc.closed {
+		cc.mu.Unlock()
+		return
+	}
+	cc.closed = true
+	pending, subscriptions := cc.pending, cc.subscriptions
+	cc.pending, cc.subscriptions = map[string]*connCall{}, map[string]*ClientSubscription{}
+	cc.mu.Unlock()
+
+	cc.conn.Close()
+	for _, call := range pending {
+		close(call.done)
+	}
+	for _, sub := range subscriptions {
+		sub.close(ErrConnClosed)
+	}
+}
@@ -0,0 +1,443 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveConn serves a connection with server and returns the other end of the connection.
+func serveConn(t *testing.T, ctx context.Context, server *Server) net.Conn {
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ServeConn(ctx, c1)
+	}()
+	t.Cleanup(func() {
+		c2.Close()
+		<-done
+	})
+	return c2
+}
+
+func TestServeConn(t *testing.T) {
+	testcases := []struct {
+		name string
+		req  string
+		resp string
+	}{
+		{
+			name: "request",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}}`,
+			resp: `{"jsonrpc":"2.0","id":1,"result":{"C":3}}`,
+		},
+		{
+			name: "batch",
+			req:  `[{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}},{"jsonrpc":"2.0","method":"sum","params":{"A":1,"B":2}},{"jsonrpc":"2.0","id":2,"method":"unknown"}]`,
+			resp: `[{"jsonrpc":"2.0","id":1,"result":{"C":3}},{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"Method not found"}}]`,
+		},
+		{
+			name: "parse_error",
+			req:  `{"jsonrpc":"2.0","id":1,`,
+			resp: `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error"}}`,
+		},
+	}
+
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	conn := serveConn(t, context.Background(), server)
+	r := bufio.NewReader(conn)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			// a notification and a blank line don't get a response
+			if _, err := conn.Write([]byte(`{"jsonrpc":"2.0","method":"sum","params":{"A":1,"B":2}}` + "\n\n" + tc.req + "\n")); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			if line != tc.resp+"\n" {
+				t.Errorf("invalid response: \ngot:  %v\nwant: %v", line, tc.resp)
+			}
+		})
+	}
+}
+
+func TestServeConnTooLarge(t *testing.T) {
+	server := NewServer(WithMaxRequestSize(16))
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	done := make(chan error)
+	go func() {
+		done <- server.ServeConn(context.Background(), c1)
+	}()
+	go c2.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"sum"}` + "\n"))
+	if err := <-done; err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestServeConnPanic(t *testing.T) {
+	testcases := []struct {
+		name string
+		req  string
+		resp string
+	}{
+		{
+			name: "request",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"panic"}`,
+			resp: `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"Internal error"}}`,
+		},
+		{
+			name: "batch",
+			req:  `[{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}},{"jsonrpc":"2.0","method":"panic"},{"jsonrpc":"2.0","id":2,"method":"panic"}]`,
+			resp: `[{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"Internal error"}},{"jsonrpc":"2.0","id":2,"error":{"code":-32603,"message":"Internal error"}}]`,
+		},
+		{
+			name: "interceptor",
+			req:  `{"jsonrpc":"2.0","id":3,"method":"sum","params":{"A":-1,"B":2}}`,
+			resp: `{"jsonrpc":"2.0","id":3,"error":{"code":-32603,"message":"Internal error"}}`,
+		},
+	}
+
+	server := NewServer(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), WithServerInterceptor(func(ctx context.Context, info *RequestInfo, next ServerInvoker) (interface{}, error) {
+		if bytes.Contains(info.Params, []byte("-1")) {
+			panic("negative")
+		}
+		return next(ctx, info)
+	}))
+	server.HandleFunc("sum", sum)
+	server.HandleFunc("panic", func(ctx context.Context) (int, error) {
+		panic("handler")
+	})
+	conn := serveConn(t, context.Background(), server)
+	r := bufio.NewReader(conn)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			// a panicking notification doesn't get a response
+			if _, err := conn.Write([]byte(`{"jsonrpc":"2.0","method":"panic"}` + "\n" + tc.req + "\n")); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			if line != tc.resp+"\n" {
+				t.Errorf("invalid response: \ngot:  %v\nwant: %v", line, tc.resp)
+			}
+		})
+	}
+}
+
+func TestServeConnMaxRequests(t *testing.T) {
+	started, release := make(chan int, 4), make(chan struct{})
+	server := NewServer(WithMaxConnRequests(2))
+	server.HandleFunc("block", func(ctx context.Context, n int) (int, error) {
+		started <- n
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-release:
+			return n, nil
+		}
+	})
+	conn := serveConn(t, context.Background(), server)
+	r := bufio.NewReader(conn)
+	write := func(msgs ...string) {
+		t.Helper()
+		if _, err := conn.Write([]byte(strings.Join(msgs, "\n") + "\n")); err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+	}
+	expectStarted := func(n int) {
+		t.Helper()
+		select {
+		case got := <-started:
+			if got != n {
+				t.Errorf("expected request %v to start, got %v", n, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("request %v not started", n)
+		}
+	}
+
+	write(`{"jsonrpc":"2.0","id":1,"method":"block","params":1}`)
+	expectStarted(1)
+	write(`{"jsonrpc":"2.0","id":2,"method":"block","params":2}`)
+	expectStarted(2)
+
+	// Both slots are taken, the cancellation is served anyway.
+	write(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":1}}`)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if want := `{"jsonrpc":"2.0","id":1,"error":{"code":-32800,"message":"Request cancelled"}}` + "\n"; line != want {
+		t.Errorf("invalid response: \ngot:  %v\nwant: %v", line, want)
+	}
+
+	write(`{"jsonrpc":"2.0","id":3,"method":"block","params":3}`, `{"jsonrpc":"2.0","id":4,"method":"block","params":4}`)
+	expectStarted(3)
+	select {
+	case n := <-started:
+		t.Fatalf("request %v started over the limit", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	// Pipe writes are synchronous, the responses are read before request 4 can take a slot.
+	var got []string
+	for i := 0; i < 3; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error not expected: %v", err)
+		}
+		got = append(got, strings.TrimSpace(line))
+	}
+	expectStarted(4)
+	sort.Strings(got)
+	want := []string{`{"jsonrpc":"2.0","id":2,"result":2}`, `{"jsonrpc":"2.0","id":3,"result":3}`, `{"jsonrpc":"2.0","id":4,"result":4}`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("invalid responses: \ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+// tempErrListener is a listener whose first Accept calls fail with a temporary error.
+type tempErrListener struct {
+	net.Listener
+	failures int
+}
+
+type tempError struct{}
+
+func (tempError) Error() string   { return "too many open files" }
+func (tempError) Timeout() bool   { return false }
+func (tempError) Temporary() bool { return true }
+
+func (l *tempErrListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, tempError{}
+	}
+	return l.Listener.Accept()
+}
+
+func TestServeAcceptRetry(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	server.HandleFunc("sum", sum)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(&tempErrListener{Listener: l, failures: 3})
+	}()
+	defer server.Shutdown(context.Background())
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}}` + "\n")); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if want := `{"jsonrpc":"2.0","id":1,"result":{"C":3}}` + "\n"; line != want {
+		t.Errorf("invalid response: \ngot:  %v\nwant: %v", line, want)
+	}
+	select {
+	case err := <-served:
+		t.Errorf("Serve returned early: %v", err)
+	default:
+	}
+}
+
+func TestConnClient(t *testing.T) {
+	checkGoroutineLeaks(t)
+
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	release := make(chan struct{})
+	server.HandleFunc("block", func(ctx context.Context) (int, error) {
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.Serve(l)
+
+	client, err := Dial(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+
+	// a blocked call doesn't delay the calls sent after it
+	blocked := client.Go(context.Background(), "block", nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Call(context.Background(), "sum", Args{A: i, B: 1})
+			if err != nil {
+				t.Errorf("sum: error not expected: %v", err)
+				return
+			}
+			reply := &Reply{}
+			if err := resp.Decode(reply); err != nil || reply.C != i+1 {
+				t.Errorf("sum: expected %v, got %v (%v)", i+1, reply.C, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := client.Notify(context.Background(), "sum", Args{A: 1, B: 2}); err != nil {
+		t.Errorf("notify: error not expected: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.Call(ctx, "block", nil); err == nil {
+		t.Errorf("block: expected error")
+	}
+
+	close(release)
+	resp, err := blocked.Result()
+	if err != nil || resp.Err() != nil {
+		t.Errorf("block: error not expected: %v %v", err, resp.Err())
+	}
+
+	client.Close()
+	if _, err := client.Call(context.Background(), "sum", Args{A: 1, B: 2}); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("expected %v, got %v", ErrConnClosed, err)
+	}
+}
+
+func TestCallKey(t *testing.T) {
+	testcases := []struct {
+		name string
+		sent interface{}
+		got  interface{}
+		same bool
+	}{
+		{name: "small", sent: int64(1), got: float64(1), same: true},
+		{name: "large", sent: int64(1000000), got: float64(1e6), same: true},
+		{name: "larger", sent: int64(123456789012), got: float64(123456789012), same: true},
+		{name: "number", sent: int64(1000000), got: json.Number("1000000"), same: true},
+		{name: "number_exponent", sent: int64(1000000), got: json.Number("1e6"), same: true},
+		{name: "string", sent: "abc", got: "abc", same: true},
+		{name: "string_number", sent: "1", got: float64(1)},
+		{name: "string_large", sent: "1000000", got: float64(1e6)},
+		{name: "fraction", sent: int64(1), got: float64(1.5)},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if same := callKey(tc.sent) == callKey(tc.got); same != tc.same {
+				t.Errorf("expected same key %v for %#v and %#v, got %q and %q", tc.same, tc.sent, tc.got, callKey(tc.sent), callKey(tc.got))
+			}
+		})
+	}
+}
+
+func TestConnClientLargeIDs(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	client := NewConnClient(serveConn(t, context.Background(), server))
+	defer client.Close()
+	client.next = 999_998
+
+	// the ids 999999, 1000000 and 1000001 are sent
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := client.Call(ctx, "sum", Args{A: i, B: 1})
+		cancel()
+		if err != nil {
+			t.Fatalf("sum %v: error not expected: %v", client.next, err)
+		}
+		reply := &Reply{}
+		if err := resp.Decode(reply); err != nil || reply.C != i+1 {
+			t.Errorf("sum %v: expected %v, got %v (%v)", client.next, i+1, reply.C, err)
+		}
+	}
+}
+
+func TestConnClientServerClosed(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("block", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewConnClient(serveConn(t, ctx, server))
+	defer client.Close()
+
+	call := client.Go(context.Background(), "block", nil)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if _, err := call.Result(); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("expected %v, got %v", ErrConnClosed, err)
+	}
+}
+
+func TestConnAuth(t *testing.T) {
+	auth := AuthenticatorFunc(func(r *http.Request, body []byte) (*Principal, error) {
+		return nil, ErrNoCredentials
+	})
+	testcases := []struct {
+		name    string
+		ctx     context.Context
+		subject string
+		err     *Error
+	}{
+		{name: "unauthenticated", ctx: context.Background(), err: ErrUnauthorized},
+		{name: "principal", ctx: ContextWithPrincipal(context.Background(), &Principal{Subject: "alice"}), subject: "alice"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewConnClient(serveConn(t, tc.ctx, newAuthServer(auth)))
+			defer client.Close()
+			resp, err := client.Call(context.Background(), "whoami", nil)
+			if err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			if tc.err != nil {
+				if !errors.Is(resp.Err(), tc.err) {
+					t.Errorf("expected %v, got %v", tc.err, resp.Err())
+				}
+				return
+			}
+			var subject string
+			if err := resp.Decode(&subject); err != nil || subject != tc.subject {
+				t.Errorf("expected subject %v, got %v (%v)", tc.subject, subject, err)
+			}
+		})
+	}
+}
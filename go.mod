@@ -1,3 +1,3 @@
 module github.com/echovl/jsonrpc
 
-go 1.13
+go 1.21
@@ -0,0 +1,72 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// Handler responds to a JSON-RPC request without going through reflection.
+// It is the extension point used by generated and typed adapters.
+type Handler interface {
+	ServeJSONRPC(ctx context.Context, params Params) (interface{}, error)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as JSON-RPC handlers.
+type HandlerFunc func(ctx context.Context, params Params) (interface{}, error)
+
+// ServeJSONRPC calls f(ctx, params).
+func (f HandlerFunc) ServeJSONRPC(ctx context.Context, params Params) (interface{}, error) {
+	return f(ctx, params)
+}
+
+// Params holds the raw params of a JSON-RPC request.
+type Params struct {
+	raw   json.RawMessage
+	codec Codec
+}
+
+// Decode unmarshals the params into v, which must be a pointer. It follows the rules
+// of HandleFunc: missing, null or zero valued params are reported as ErrInvalidParams.
+func (p Params) Decode(v interface{}) error {
+	if p.raw == nil || string(p.raw) == string(null) {
+		return ErrInvalidParams
+	}
+	if err := p.codec.Unmarshal(p.raw, v); err != nil {
+		return ErrInvalidParams
+	}
+	pv := reflect.ValueOf(v)
+	for pv.Kind() == reflect.Ptr && !pv.IsNil() {
+		pv = pv.Elem()
+	}
+	if pv.IsZero() {
+		return ErrInvalidParams
+	}
+	return nil
+}
+
+// Raw returns the params as received, it is nil if the request had no params.
+func (p Params) Raw() json.RawMessage {
+	return p.raw
+}
+
+// Handle registers f for the given JSON-RPC method. The params and result types
+// are checked at compile time and the call doesn't go through reflection.
+func Handle[P, R any](s *Server, method string, f func(context.Context, P) (R, error), opts ...MethodOption) {
+	opts = append([]MethodOption{withTypes(reflect.TypeOf((*P)(nil)).Elem(), reflect.TypeOf((*R)(nil)).Elem())}, opts...)
+	s.Handle(method, HandlerFunc(func(ctx context.Context, params Params) (interface{}, error) {
+		var p P
+		if err := params.Decode(&p); err != nil {
+			return nil, err
+		}
+		return f(ctx, p)
+	}), opts...)
+}
+
+// HandleNoParams registers f, a handler that takes no params, for the given JSON-RPC method.
+func HandleNoParams[R any](s *Server, method string, f func(context.Context) (R, error), opts ...MethodOption) {
+	opts = append([]MethodOption{withTypes(nil, reflect.TypeOf((*R)(nil)).Elem())}, opts...)
+	s.Handle(method, HandlerFunc(func(ctx context.Context, params Params) (interface{}, error) {
+		return f(ctx)
+	}), opts...)
+}
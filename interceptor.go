@@ -0,0 +1,86 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// RequestInfo describes a JSON-RPC request seen by an interceptor.
+type RequestInfo struct {
+	Method       string
+	ID           interface{} // nil for notifications
+	Params       json.RawMessage
+	Notification bool
+	// Header holds the headers of the HTTP request. On the server it is read-only, on
+	// the client the headers set by the interceptors are added to the HTTP request. It is
+	// nil on the server, and not sent by the client, for requests over a connection.
+	Header     http.Header
+	RemoteAddr string // address of the client, only set on the server
+}
+
+// ServerInvoker executes a request on the server. Its errors are *Error values, with the
+// code sent to the client.
+type ServerInvoker func(ctx context.Context, info *RequestInfo) (interface{}, error)
+
+// ServerInterceptor runs around the execution of every request of a registered method,
+// including each request of a batch. It may replace the context, reject the request by
+// returning an error, or observe the result and the error returned by next.
+type ServerInterceptor func(ctx context.Context, info *RequestInfo, next ServerInvoker) (interface{}, error)
+
+// ClientInvoker sends a request from the client. The response is nil for notifications.
+type ClientInvoker func(ctx context.Context, info *RequestInfo) (*Response, error)
+
+// ClientInterceptor runs around every Call, Go and Notify of a Client, retries included.
+// It may set headers on info.Header, replace the context, or observe the response.
+type ClientInterceptor func(ctx context.Context, info *RequestInfo, next ClientInvoker) (*Response, error)
+
+// WithServerInterceptor adds interceptors to the Server, the first one runs outermost.
+func WithServerInterceptor(interceptors ...ServerInterceptor) ServerOption {
+	return func(s *Server) {
+		s.interceptors = append(s.interceptors, interceptors...)
+	}
+}
+
+// WithClientInterceptor adds interceptors to the Client, the first one runs outermost.
+func WithClientInterceptor(interceptors ...ClientInterceptor) ClientOption {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+func (s *Server) intercept(ctx context.Context, info *RequestInfo, invoke ServerInvoker) (interface{}, error) {
+	for i := len(s.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := s.interceptors[i], invoke
+		invoke = func(ctx context.Context, info *RequestInfo) (interface{}, error) {
+			return interceptor(ctx, info, next)
+		}
+	}
+	return invoke(ctx, info)
+}
+
+// intercept runs invoke through the interceptors of the client, the headers they set
+// are sent with req.
+func (c *Client) intercept(ctx context.Context, req *request, invoke func(ctx context.Context, req *request) (*Response, error)) (*Response, error) {
+	if len(c.interceptors) == 0 {
+		return invoke(ctx, req)
+	}
+	info := &RequestInfo{
+		Method:       req.Method,
+		ID:           req.ID,
+		Params:       req.Params,
+		Notification: req.ID == nil,
+		Header:       http.Header{},
+	}
+	next := ClientInvoker(func(ctx context.Context, info *RequestInfo) (*Response, error) {
+		req.Params, req.header = info.Params, info.Header
+		return invoke(ctx, req)
+	})
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := c.interceptors[i], next
+		next = func(ctx context.Context, info *RequestInfo) (*Response, error) {
+			return interceptor(ctx, info, inner)
+		}
+	}
+	return next(ctx, info)
+}
@@ -0,0 +1,77 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	var calls []string
+	record := func(name string) ServerInterceptor {
+		return func(ctx context.Context, info *RequestInfo, next ServerInvoker) (interface{}, error) {
+			result, err := next(ctx, info)
+			code := 0
+			var rpcErr *Error
+			if errors.As(err, &rpcErr) {
+				code = rpcErr.Code
+			}
+			calls = append(calls, fmt.Sprintf("%v %v %v %v %v", name, info.Method, info.Notification, info.Header.Get("X-Test"), code))
+			return result, err
+		}
+	}
+	reject := func(ctx context.Context, info *RequestInfo, next ServerInvoker) (interface{}, error) {
+		if info.Method == "rejected" {
+			return nil, &Error{Code: 403, Message: "Forbidden"}
+		}
+		return next(ctx, info)
+	}
+	server := NewServer(WithServerInterceptor(record("outer"), record("inner"), reject))
+	server.HandleFunc("sum", sum)
+	server.HandleFunc("rejected", sum)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	header := func(ctx context.Context, info *RequestInfo, next ClientInvoker) (*Response, error) {
+		info.Header.Set("X-Test", "value")
+		return next(ctx, info)
+	}
+	client := NewClient(ts.URL, WithClientInterceptor(header))
+
+	if _, err := client.Call(context.Background(), "sum", Args{1, 2}); err != nil {
+		t.Fatalf("sum: error not expected: %v", err)
+	}
+	resp, err := client.Call(context.Background(), "rejected", Args{1, 2})
+	if err != nil {
+		t.Fatalf("rejected: error not expected: %v", err)
+	}
+	if resp.Err() == nil || resp.Err().Error() != "jsonrpc: forbidden" {
+		t.Errorf("rejected: expected forbidden error, got %v", resp.Err())
+	}
+	if _, err := client.Call(context.Background(), "sum", nil); err != nil {
+		t.Fatalf("sum: error not expected: %v", err)
+	}
+	if err := client.Notify(context.Background(), "sum", Args{1, 2}); err != nil {
+		t.Fatalf("sum: error not expected: %v", err)
+	}
+	if _, err := client.Call(context.Background(), "unknown", nil); err != nil {
+		t.Fatalf("unknown: error not expected: %v", err)
+	}
+
+	want := []string{
+		"inner sum false value 0",
+		"outer sum false value 0",
+		"inner rejected false value 403",
+		"outer rejected false value 403",
+		"inner sum false value -32602",
+		"outer sum false value -32602",
+		"inner sum true value 0",
+		"outer sum true value 0",
+	}
+	if got := strings.Join(calls, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("invalid interceptor calls: \ngot:\n%v\nwant:\n%v\n", got, strings.Join(want, "\n"))
+	}
+}
@@ -1,19 +1,24 @@
 package jsonrpc
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 )
 
 var (
-	ErrorParseError   = &Error{-32700, "Parse error", nil}
-	ErrInvalidRequest = &Error{-32600, "Invalid Request", nil}
-	ErrMethodNotFound = &Error{-32601, "Method not found", nil}
-	ErrInvalidParams  = &Error{-32602, "Invalid params", nil}
-	ErrInternalError  = &Error{-32603, "Internal error", nil}
-	//ErrServerError    = Error{-32000, "Parse error", nil}
+	ErrorParseError   = &Error{Code: -32700, Message: "Parse error"}
+	ErrInvalidRequest = &Error{Code: -32600, Message: "Invalid Request"}
+	ErrMethodNotFound = &Error{Code: -32601, Message: "Method not found"}
+	ErrInvalidParams  = &Error{Code: -32602, Message: "Invalid params"}
+	ErrInternalError  = &Error{Code: -32603, Message: "Internal error"}
+	ErrServerError    = &Error{Code: -32000, Message: "Server error"}
 )
 
+var errNoErrorData = errors.New("jsonrpc: error has no data")
+
 // Error represents a JSON-RPC error, it implements the error interface.
 type Error struct {
 	Code    int         `json:"code"`
@@ -21,7 +26,161 @@ type Error struct {
 	Data    interface{} `json:"data,omitempty"` // defined by the server
 }
 
+// errorMessage is the encoded representation of an error received by a client.
+type errorMessage struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// clientError is an error received by a client, returned by Response.Err. It unwraps
+// to its *Error and keeps the data as received, so DecodeData unmarshals it with the
+// Codec of the client.
+type clientError struct {
+	err   *Error
+	data  json.RawMessage
+	codec Codec
+}
+
+func (e *clientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *clientError) Unwrap() error {
+	return e.err
+}
+
+// DecodeData unmarshals the raw data of the error into v.
+func (e *clientError) DecodeData(v interface{}) error {
+	if e.data == nil {
+		return errNoErrorData
+	}
+	return e.codec.Unmarshal(e.data, v)
+}
+
+// DecodeData unmarshals the Data of the error into v. The errors returned by a client
+// decode the data sent by the server with the Codec of the client, call DecodeData on
+// the error returned by Response.Err or use ErrorCode.Data.
+func (e *Error) DecodeData(v interface{}) error {
+	if e.Data == nil {
+		return errNoErrorData
+	}
+	b, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
 // Error returns the string representation of the error.
 func (e *Error) Error() string {
 	return fmt.Sprint("jsonrpc: ", strings.ToLower(e.Message))
 }
+
+// Is reports whether target is a JSON-RPC error with the same code, so errors
+// decoded by a client match the predefined ones: errors.Is(err, ErrMethodNotFound).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t != nil && t.Code == e.Code
+}
+
+// ErrorCoder is implemented by application errors that carry their own JSON-RPC code.
+// If the error also has an ErrorData() interface{} method, its result is sent as the Data.
+type ErrorCoder interface {
+	error
+	ErrorCode() int
+}
+
+type errorDataer interface {
+	ErrorData() interface{}
+}
+
+// ErrorCode is an application error code registered with NewErrorCode, its Data has type T.
+type ErrorCode[T any] struct {
+	Code    int
+	Message string
+}
+
+// errorCodes is the registry of application error codes.
+var errorCodes sync.Map
+
+// NewErrorCode registers an application error code and the type of its Data. It panics
+// if the code is reserved by the JSON-RPC specification or is already registered.
+func NewErrorCode[T any](code int, message string) ErrorCode[T] {
+	if code >= -32768 && code <= -32000 {
+		panic(fmt.Sprintf("jsonrpc: error code %v is reserved", code))
+	}
+	if _, loaded := errorCodes.LoadOrStore(code, message); loaded {
+		panic(fmt.Sprintf("jsonrpc: error code %v already registered", code))
+	}
+	return ErrorCode[T]{Code: code, Message: message}
+}
+
+// LookupErrorCode returns the message of a registered application error code.
+func LookupErrorCode(code int) (message string, ok bool) {
+	v, ok := errorCodes.Load(code)
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+// New returns a JSON-RPC error with the code and the given data.
+func (c ErrorCode[T]) New(data T) *Error {
+	return &Error{Code: c.Code, Message: c.Message, Data: data}
+}
+
+// Is reports whether err is, or wraps, a JSON-RPC error with the code.
+func (c ErrorCode[T]) Is(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == c.Code
+}
+
+// Data returns the typed data of err if it is, or wraps, a JSON-RPC error with the code.
+// It works both for errors returned by handlers and for errors decoded by a client.
+func (c ErrorCode[T]) Data(err error) (T, bool) {
+	var data T
+	var e *Error
+	if !errors.As(err, &e) || e.Code != c.Code {
+		return data, false
+	}
+	if v, ok := e.Data.(T); ok {
+		return v, true
+	}
+	decoder := interface{ DecodeData(v interface{}) error }(e)
+	var ce *clientError
+	if errors.As(err, &ce) && ce.err == e {
+		decoder = ce
+	}
+	if err := decoder.DecodeData(&data); err != nil {
+		return data, false
+	}
+	return data, true
+}
+
+// asError converts an error returned by a handler into a JSON-RPC error. Wrapped
+// errors are unwrapped, errors registered on the server or implementing ErrorCoder
+// keep their code, and any other error becomes ErrServerError.
+func (s *Server) asError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		e := &Error{Code: coder.ErrorCode(), Message: coder.Error()}
+		if dataer, ok := coder.(errorDataer); ok {
+			e.Data = dataer.ErrorData()
+		}
+		return e
+	}
+	for _, r := range s.registeredErrors {
+		if errors.Is(err, r.target) {
+			return &Error{Code: r.code, Message: r.target.Error()}
+		}
+	}
+	if s.hideInternalErrors {
+		return ErrServerError
+	}
+	return &Error{Code: ErrServerError.Code, Message: err.Error()}
+}
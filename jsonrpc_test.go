@@ -0,0 +1,123 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+type NotFoundData struct {
+	Resource string `json:"resource"`
+}
+
+var errNotFound = NewErrorCode[NotFoundData](404, "Not found")
+
+type quotaError struct {
+	limit int
+}
+
+func (e quotaError) Error() string          { return fmt.Sprintf("quota of %v exceeded", e.limit) }
+func (e quotaError) ErrorCode() int         { return 429 }
+func (e quotaError) ErrorData() interface{} { return e.limit }
+
+func TestErrorIs(t *testing.T) {
+	decoded := &Error{Code: -32601, Message: "Method not found"}
+	if !errors.Is(fmt.Errorf("calling: %w", decoded), ErrMethodNotFound) {
+		t.Errorf("decoded error doesn't match ErrMethodNotFound")
+	}
+	if errors.Is(decoded, ErrInvalidParams) {
+		t.Errorf("decoded error matches ErrInvalidParams")
+	}
+	if errors.Is(decoded, (*Error)(nil)) {
+		t.Errorf("decoded error matches a nil *Error")
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	err := fmt.Errorf("loading user: %w", errNotFound.New(NotFoundData{"user"}))
+	if !errNotFound.Is(err) {
+		t.Errorf("error doesn't match the not found code")
+	}
+	data, ok := errNotFound.Data(err)
+	if !ok || data.Resource != "user" {
+		t.Errorf("invalid data:\ngot: %v\nwant: user", data)
+	}
+
+	// Data decoded by a client is a generic JSON value.
+	decoded := &Error{Code: 404, Message: "Not found", Data: map[string]interface{}{"resource": "post"}}
+	data, ok = errNotFound.Data(decoded)
+	if !ok || data.Resource != "post" {
+		t.Errorf("invalid decoded data:\ngot: %v\nwant: post", data)
+	}
+
+	if msg, ok := LookupErrorCode(404); !ok || msg != "Not found" {
+		t.Errorf("invalid registered code:\ngot: %v\nwant: Not found", msg)
+	}
+
+	for _, code := range []int{404, -32001} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering code %v: expected panic", code)
+				}
+			}()
+			NewErrorCode[string](code, "duplicated")
+		}()
+	}
+}
+
+func TestServeErrorModel(t *testing.T) {
+	testcases := []struct {
+		name string
+		opts []ServerOption
+		err  error
+		resp string
+	}{
+		{
+			name: "wrapped_error",
+			err:  fmt.Errorf("loading user: %w", errNotFound.New(NotFoundData{"user"})),
+			resp: `{"jsonrpc":"2.0","id":1,"error":{"code":404,"message":"Not found","data":{"resource":"user"}}}`,
+		},
+		{
+			name: "error_coder",
+			err:  fmt.Errorf("charging: %w", quotaError{10}),
+			resp: `{"jsonrpc":"2.0","id":1,"error":{"code":429,"message":"quota of 10 exceeded","data":10}}`,
+		},
+		{
+			name: "registered_error",
+			opts: []ServerOption{WithRegisteredError(io.EOF, 1)},
+			err:  fmt.Errorf("reading: %w", io.EOF),
+			resp: `{"jsonrpc":"2.0","id":1,"error":{"code":1,"message":"EOF"}}`,
+		},
+		{
+			name: "internal_error",
+			err:  errors.New("connecting to 10.0.0.1: refused"),
+			resp: `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"connecting to 10.0.0.1: refused"}}`,
+		},
+		{
+			name: "hidden_internal_error",
+			opts: []ServerOption{WithHiddenInternalErrors()},
+			err:  errors.New("connecting to 10.0.0.1: refused"),
+			resp: `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"Server error"}}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(tc.opts...)
+			server.HandleFunc("fail", func(ctx context.Context) (string, error) {
+				return "", tc.err
+			})
+			req := httptest.NewRequest("POST", "locahost:8080", bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"fail"}`)))
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+
+			if got := rw.Body.String(); got != tc.resp {
+				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, tc.resp)
+			}
+		})
+	}
+}
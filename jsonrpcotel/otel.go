@@ -0,0 +1,199 @@
+// Package jsonrpcotel traces JSON-RPC calls with OpenTelemetry. It lives in its own
+// module so the jsonrpc package doesn't depend on OpenTelemetry.
+//
+// The client interceptor starts a client span per call and sends its context in the
+// W3C traceparent header, the server interceptor continues the trace with a server
+// span named after the method:
+//
+//	client := jsonrpc.NewClient(url, jsonrpc.WithClientInterceptor(jsonrpcotel.ClientInterceptor()))
+//	server := jsonrpc.NewServer(jsonrpc.WithServerInterceptor(jsonrpcotel.ServerInterceptor()))
+//	http.Handle("/rpc", jsonrpcotel.Handler(server))
+package jsonrpcotel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/echovl/jsonrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/echovl/jsonrpc/jsonrpcotel"
+
+// Attribute keys of the spans, following the OpenTelemetry semantic conventions for JSON-RPC.
+const (
+	SystemKey       = attribute.Key("rpc.system")
+	MethodKey       = attribute.Key("rpc.method")
+	VersionKey      = attribute.Key("rpc.jsonrpc.version")
+	RequestIDKey    = attribute.Key("rpc.jsonrpc.request_id")
+	ErrorCodeKey    = attribute.Key("rpc.jsonrpc.error_code")
+	ErrorMessageKey = attribute.Key("rpc.jsonrpc.error_message")
+	NotificationKey = attribute.Key("rpc.jsonrpc.notification")
+)
+
+// BatchSpanName is the name of the spans started by Handler for batches.
+const BatchSpanName = "jsonrpc.batch"
+
+type config struct {
+	provider    trace.TracerProvider
+	propagators propagation.TextMapPropagator
+}
+
+// Option configures the instrumentation.
+type Option func(*config)
+
+// WithTracerProvider sets the TracerProvider, the default is the global one.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = provider
+	}
+}
+
+// WithPropagators sets the propagators of the span context, the default is W3C Trace Context.
+func WithPropagators(propagators propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagators = propagators
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{provider: otel.GetTracerProvider(), propagators: propagation.TraceContext{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *config) tracer() trace.Tracer {
+	return c.provider.Tracer(instrumentationName)
+}
+
+// ServerInterceptor returns an interceptor that starts a server span for each request.
+// The parent is the span of the context if any, the one started by Handler for batches,
+// or else the one sent in the headers of the HTTP request.
+func ServerInterceptor(opts ...Option) jsonrpc.ServerInterceptor {
+	cfg := newConfig(opts)
+	tracer := cfg.tracer()
+	return func(ctx context.Context, info *jsonrpc.RequestInfo, next jsonrpc.ServerInvoker) (interface{}, error) {
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			ctx = cfg.propagators.Extract(ctx, propagation.HeaderCarrier(info.Header))
+		}
+		ctx, span := tracer.Start(ctx, info.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(requestAttributes(info)...),
+		)
+		defer span.End()
+
+		result, err := next(ctx, info)
+		setError(span, err)
+		return result, err
+	}
+}
+
+// ClientInterceptor returns an interceptor that starts a client span for each call
+// and sends its context in the headers of the HTTP request.
+func ClientInterceptor(opts ...Option) jsonrpc.ClientInterceptor {
+	cfg := newConfig(opts)
+	tracer := cfg.tracer()
+	return func(ctx context.Context, info *jsonrpc.RequestInfo, next jsonrpc.ClientInvoker) (*jsonrpc.Response, error) {
+		ctx, span := tracer.Start(ctx, info.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(requestAttributes(info)...),
+		)
+		defer span.End()
+		cfg.propagators.Inject(ctx, propagation.HeaderCarrier(info.Header))
+
+		resp, err := next(ctx, info)
+		if err == nil && resp != nil {
+			setError(span, resp.Err())
+		} else {
+			setError(span, err)
+		}
+		return resp, err
+	}
+}
+
+// Handler wraps the http.Handler of a jsonrpc.Server to start a span for each batch,
+// the spans of the requests of the batch are its children. Compressed batches are not
+// detected, their requests are traced on their own.
+func Handler(h http.Handler, opts ...Option) http.Handler {
+	cfg := newConfig(opts)
+	tracer := cfg.tracer()
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Encoding") != "" {
+			h.ServeHTTP(rw, r)
+			return
+		}
+		body := bufio.NewReader(r.Body)
+		r.Body = readCloser{Reader: body, Closer: r.Body}
+		if !isBatch(body) {
+			h.ServeHTTP(rw, r)
+			return
+		}
+
+		ctx := cfg.propagators.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, BatchSpanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(SystemKey.String("jsonrpc"), VersionKey.String("2.0")),
+		)
+		defer span.End()
+		h.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// isBatch reports whether the first value of the body is an array, without consuming it.
+func isBatch(r *bufio.Reader) bool {
+	for n := 1; ; n++ {
+		b, err := r.Peek(n)
+		if len(b) < n || err != nil {
+			return false
+		}
+		switch b[n-1] {
+		case ' ', '\t', '\r', '\n':
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func requestAttributes(info *jsonrpc.RequestInfo) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		SystemKey.String("jsonrpc"),
+		MethodKey.String(info.Method),
+		VersionKey.String("2.0"),
+		NotificationKey.Bool(info.Notification),
+	}
+	if info.ID != nil {
+		attrs = append(attrs, RequestIDKey.String(fmt.Sprint(info.ID)))
+	}
+	return attrs
+}
+
+func setError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	var rpcErr *jsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		span.SetAttributes(ErrorCodeKey.Int(rpcErr.Code), ErrorMessageKey.String(rpcErr.Message))
+		span.SetStatus(codes.Error, rpcErr.Message)
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
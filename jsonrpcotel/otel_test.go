@@ -0,0 +1,138 @@
+package jsonrpcotel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/echovl/jsonrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Args struct {
+	A, B int
+}
+
+func sum(ctx context.Context, args Args) (int, error) {
+	return args.A + args.B, nil
+}
+
+func newTestServer(t *testing.T, provider trace.TracerProvider) *httptest.Server {
+	server := jsonrpc.NewServer(jsonrpc.WithServerInterceptor(ServerInterceptor(WithTracerProvider(provider))))
+	server.HandleFunc("sum", sum)
+	ts := httptest.NewServer(Handler(server, WithTracerProvider(provider)))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+func TestTraceCall(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ts := newTestServer(t, provider)
+	client := jsonrpc.NewClient(ts.URL, jsonrpc.WithClientInterceptor(ClientInterceptor(WithTracerProvider(provider))))
+
+	if _, err := client.Call(context.Background(), "sum", Args{1, 2}); err != nil {
+		t.Fatalf("sum: error not expected: %v", err)
+	}
+	resp, err := client.Call(context.Background(), "sum", nil)
+	if err != nil {
+		t.Fatalf("sum: error not expected: %v", err)
+	}
+	if resp.Err() == nil {
+		t.Fatal("sum: expected invalid params error")
+	}
+
+	spans := exporter.GetSpans().Snapshots()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %v", len(spans))
+	}
+	// spans are exported when they end, the server span first
+	server, client1 := spans[0], spans[1]
+	if server.SpanKind() != trace.SpanKindServer || client1.SpanKind() != trace.SpanKindClient {
+		t.Fatalf("invalid span kinds: %v, %v", server.SpanKind(), client1.SpanKind())
+	}
+	if server.Name() != "sum" || client1.Name() != "sum" {
+		t.Errorf("invalid span names: %v, %v", server.Name(), client1.Name())
+	}
+	if server.Parent().SpanID() != client1.SpanContext().SpanID() || !server.Parent().IsRemote() {
+		t.Errorf("server span is not a child of the client span")
+	}
+	attrs := attributes(server)
+	if attrs[MethodKey] != "sum" || attrs[RequestIDKey] != "1" || attrs[NotificationKey] != "false" || attrs[SystemKey] != "jsonrpc" {
+		t.Errorf("invalid server span attributes: %v", attrs)
+	}
+
+	for _, span := range spans[2:] {
+		if got := attributes(span)[ErrorCodeKey]; got != "-32602" {
+			t.Errorf("%v span: expected error code -32602, got %q", span.SpanKind(), got)
+		}
+	}
+}
+
+func TestTraceNotification(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ts := newTestServer(t, provider)
+	client := jsonrpc.NewClient(ts.URL, jsonrpc.WithClientInterceptor(ClientInterceptor(WithTracerProvider(provider))))
+
+	if err := client.Notify(context.Background(), "sum", Args{1, 2}); err != nil {
+		t.Fatalf("sum: error not expected: %v", err)
+	}
+	for _, span := range exporter.GetSpans().Snapshots() {
+		attrs := attributes(span)
+		if attrs[NotificationKey] != "true" {
+			t.Errorf("%v span: expected notification attribute, got %v", span.SpanKind(), attrs)
+		}
+		if _, ok := attrs[RequestIDKey]; ok {
+			t.Errorf("%v span: request id not expected", span.SpanKind())
+		}
+	}
+}
+
+func TestTraceBatch(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ts := newTestServer(t, provider)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	body := `[{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}},{"jsonrpc":"2.0","id":2,"method":"sum","params":{"A":3,"B":4}}]`
+	req, _ := http.NewRequestWithContext(ctx, "POST", ts.URL, strings.NewReader(body))
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	hres, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hres.Body.Close()
+	parent.End()
+
+	spans := exporter.GetSpans().Snapshots()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %v", len(spans))
+	}
+	first, second, batch := spans[0], spans[1], spans[2]
+	if batch.Name() != BatchSpanName || batch.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("invalid batch span: %v, parent %v", batch.Name(), batch.Parent().SpanID())
+	}
+	for i, span := range []sdktrace.ReadOnlySpan{first, second} {
+		if span.Parent().SpanID() != batch.SpanContext().SpanID() {
+			t.Errorf("request %v: span is not a child of the batch span", i)
+		}
+		if got := attributes(span)[RequestIDKey]; got != []string{"1", "2"}[i] {
+			t.Errorf("request %v: invalid request id %v", i, got)
+		}
+	}
+}
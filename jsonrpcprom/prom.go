@@ -0,0 +1,122 @@
+// Package jsonrpcprom exposes the metrics of JSON-RPC servers and clients to Prometheus.
+// It lives in its own module so the jsonrpc package doesn't depend on Prometheus.
+//
+//	metrics := jsonrpcprom.NewServerMetrics()
+//	prometheus.MustRegister(metrics)
+//	server := jsonrpc.NewServer(jsonrpc.WithServerMetrics(metrics))
+package jsonrpcprom
+
+import (
+	"strconv"
+
+	"github.com/echovl/jsonrpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics is a jsonrpc.MetricsRecorder and a prometheus.Collector. It exports, per method:
+//
+//	jsonrpc_<side>_requests_total{method,code}       requests, by JSON-RPC error code ("0" on success, "error" if no response was received)
+//	jsonrpc_<side>_request_duration_seconds{method}  latency histogram
+//	jsonrpc_<side>_in_flight_requests{method}        requests being executed
+//	jsonrpc_<side>_request_size_bytes{method}        request size histogram
+//	jsonrpc_<side>_response_size_bytes{method}       response size histogram, notifications excluded
+//
+// where side is server or client.
+type Metrics struct {
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	inFlight      *prometheus.GaugeVec
+	requestSizes  *prometheus.HistogramVec
+	responseSizes *prometheus.HistogramVec
+}
+
+var _ jsonrpc.MetricsRecorder = (*Metrics)(nil)
+
+// sizeBuckets range from 64 bytes to 16 MiB.
+var sizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+// NewServerMetrics returns the metrics of a server, set them with jsonrpc.WithServerMetrics.
+func NewServerMetrics() *Metrics {
+	return newMetrics("server")
+}
+
+// NewClientMetrics returns the metrics of a client, set them with jsonrpc.WithClientMetrics.
+func NewClientMetrics() *Metrics {
+	return newMetrics("client")
+}
+
+func newMetrics(side string) *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "jsonrpc",
+			Subsystem: side,
+			Name:      "requests_total",
+			Help:      "Number of JSON-RPC requests, by method and error code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "jsonrpc",
+			Subsystem: side,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the JSON-RPC requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "jsonrpc",
+			Subsystem: side,
+			Name:      "in_flight_requests",
+			Help:      "Number of JSON-RPC requests being executed.",
+		}, []string{"method"}),
+		requestSizes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "jsonrpc",
+			Subsystem: side,
+			Name:      "request_size_bytes",
+			Help:      "Size of the JSON-RPC requests.",
+			Buckets:   sizeBuckets,
+		}, []string{"method"}),
+		responseSizes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "jsonrpc",
+			Subsystem: side,
+			Name:      "response_size_bytes",
+			Help:      "Size of the JSON-RPC responses.",
+			Buckets:   sizeBuckets,
+		}, []string{"method"}),
+	}
+}
+
+// RequestStarted implements jsonrpc.MetricsRecorder.
+func (m *Metrics) RequestStarted(method string) {
+	m.inFlight.WithLabelValues(method).Inc()
+}
+
+// RequestFinished implements jsonrpc.MetricsRecorder.
+func (m *Metrics) RequestFinished(r jsonrpc.RequestMetrics) {
+	m.inFlight.WithLabelValues(r.Method).Dec()
+	code := strconv.Itoa(r.Code)
+	if r.Err != nil {
+		code = "error"
+	}
+	m.requests.WithLabelValues(r.Method, code).Inc()
+	m.duration.WithLabelValues(r.Method).Observe(r.Duration.Seconds())
+	m.requestSizes.WithLabelValues(r.Method).Observe(float64(r.RequestSize))
+	if !r.Notification && r.Err == nil {
+		m.responseSizes.WithLabelValues(r.Method).Observe(float64(r.ResponseSize))
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.duration.Describe(ch)
+	m.inFlight.Describe(ch)
+	m.requestSizes.Describe(ch)
+	m.responseSizes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.duration.Collect(ch)
+	m.inFlight.Collect(ch)
+	m.requestSizes.Collect(ch)
+	m.responseSizes.Collect(ch)
+}
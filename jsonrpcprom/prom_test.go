@@ -0,0 +1,63 @@
+package jsonrpcprom
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/echovl/jsonrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type Args struct {
+	A, B int
+}
+
+func sum(ctx context.Context, args Args) (int, error) {
+	return args.A + args.B, nil
+}
+
+func TestMetrics(t *testing.T) {
+	smetrics, cmetrics := NewServerMetrics(), NewClientMetrics()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(smetrics, cmetrics)
+
+	server := jsonrpc.NewServer(jsonrpc.WithServerMetrics(smetrics))
+	server.HandleFunc("sum", sum)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := jsonrpc.NewClient(ts.URL, jsonrpc.WithClientMetrics(cmetrics))
+
+	client.Call(context.Background(), "sum", Args{1, 2})
+	client.Call(context.Background(), "sum", Args{1, 2})
+	client.Call(context.Background(), "sum", nil)
+	jsonrpc.NewClient("http://127.0.0.1:1", jsonrpc.WithClientMetrics(cmetrics)).Call(context.Background(), "sum", Args{1, 2})
+
+	want := `
+# HELP jsonrpc_client_requests_total Number of JSON-RPC requests, by method and error code.
+# TYPE jsonrpc_client_requests_total counter
+jsonrpc_client_requests_total{code="-32602",method="sum"} 1
+jsonrpc_client_requests_total{code="0",method="sum"} 2
+jsonrpc_client_requests_total{code="error",method="sum"} 1
+# HELP jsonrpc_server_in_flight_requests Number of JSON-RPC requests being executed.
+# TYPE jsonrpc_server_in_flight_requests gauge
+jsonrpc_server_in_flight_requests{method="sum"} 0
+# HELP jsonrpc_server_requests_total Number of JSON-RPC requests, by method and error code.
+# TYPE jsonrpc_server_requests_total counter
+jsonrpc_server_requests_total{code="-32602",method="sum"} 1
+jsonrpc_server_requests_total{code="0",method="sum"} 2
+`
+	names := []string{"jsonrpc_client_requests_total", "jsonrpc_server_in_flight_requests", "jsonrpc_server_requests_total"}
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+
+	if got := testutil.CollectAndCount(smetrics, "jsonrpc_server_request_duration_seconds"); got != 1 {
+		t.Errorf("expected 1 latency histogram, got %v", got)
+	}
+	if got := testutil.CollectAndCount(cmetrics, "jsonrpc_client_response_size_bytes"); got != 1 {
+		t.Errorf("expected 1 response size histogram, got %v", got)
+	}
+}
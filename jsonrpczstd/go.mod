@@ -0,0 +1,10 @@
+module github.com/echovl/jsonrpc/jsonrpczstd
+
+go 1.25.0
+
+require (
+	github.com/echovl/jsonrpc v0.0.0-00010101000000-000000000000
+	github.com/klauspost/compress v1.20.1
+)
+
+replace github.com/echovl/jsonrpc => ../
@@ -0,0 +1,41 @@
+// Package jsonrpczstd implements the zstd content coding for the compression of
+// JSON-RPC requests and responses. It lives in its own module so the jsonrpc package
+// doesn't depend on a zstd implementation.
+//
+//	server := jsonrpc.NewServer(jsonrpc.WithServerCompression(1024, jsonrpczstd.Zstd, jsonrpc.Gzip))
+//	client := jsonrpc.NewClient(url, jsonrpc.WithClientCompression(jsonrpczstd.Zstd, 1024))
+package jsonrpczstd
+
+import (
+	"io"
+
+	"github.com/echovl/jsonrpc"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Zstd is the zstd content coding of RFC 8878.
+var Zstd jsonrpc.Compressor = compressor{}
+
+type compressor struct{}
+
+func (compressor) Name() string {
+	return "zstd"
+}
+
+// NewWriter returns a single threaded encoder, bodies are compressed one per call.
+func (compressor) NewWriter(w io.Writer) io.WriteCloser {
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		// Only returned for invalid options.
+		panic(err)
+	}
+	return enc
+}
+
+func (compressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return dec.IOReadCloser(), nil
+}
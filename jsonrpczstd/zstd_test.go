@@ -0,0 +1,74 @@
+package jsonrpczstd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/echovl/jsonrpc"
+)
+
+func TestRoundTrip(t *testing.T) {
+	text := strings.Repeat("text", 1000)
+	var buf bytes.Buffer
+	w := Zstd.NewWriter(&buf)
+	if _, err := io.WriteString(w, text); err != nil {
+		t.Fatalf("write: error not expected: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: error not expected: %v", err)
+	}
+	if buf.Len() >= len(text) {
+		t.Errorf("expected compressed size below %v bytes, got %v", len(text), buf.Len())
+	}
+	r, err := Zstd.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("reader: error not expected: %v", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: error not expected: %v", err)
+	}
+	if string(got) != text {
+		t.Errorf("invalid decompressed body of %v bytes", len(got))
+	}
+}
+
+func TestCompression(t *testing.T) {
+	server := jsonrpc.NewServer(jsonrpc.WithServerCompression(0, Zstd))
+	server.HandleFunc("echo", func(ctx context.Context, s string) (string, error) {
+		return s, nil
+	})
+	var reqEncoding, respEncoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		reqEncoding = r.Header.Get("Content-Encoding")
+		server.ServeHTTP(rw, r)
+		respEncoding = rw.Header().Get("Content-Encoding")
+	}))
+	defer ts.Close()
+
+	client := jsonrpc.NewClient(ts.URL, jsonrpc.WithClientCompression(Zstd, 0))
+	text := strings.Repeat("text", 1000)
+	resp, err := client.Call(context.Background(), "echo", text)
+	if err != nil {
+		t.Fatalf("echo: error not expected: %v", err)
+	}
+	var got string
+	if err := resp.Decode(&got); err != nil {
+		t.Fatalf("echo: error not expected: %v", err)
+	}
+	if got != text {
+		t.Errorf("echo: invalid result of %v bytes", len(got))
+	}
+	if reqEncoding != "zstd" {
+		t.Errorf("expected request encoding zstd, got %q", reqEncoding)
+	}
+	if respEncoding != "zstd" {
+		t.Errorf("expected response encoding zstd, got %q", respEncoding)
+	}
+}
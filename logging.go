@@ -0,0 +1,85 @@
+package jsonrpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithLogger sets the logger of the Server, the default is slog.Default(). Malformed
+// requests are logged at the Warn level, and handler errors that aren't sent to the
+// client and failures to write responses at the Error level.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithAccessLog logs every request at the Info level, with its method, id, params,
+// error code, duration and the address of the client.
+func WithAccessLog() ServerOption {
+	return func(s *Server) {
+		s.accessLog = true
+	}
+}
+
+// WithRedactedParams leaves the params of the requests out of the access log.
+func WithRedactedParams() ServerOption {
+	return func(s *Server) {
+		s.redactParams = true
+	}
+}
+
+// WithClientLogger sets the logger of the Client, the default is slog.Default(). Retries
+// are logged at the Debug level and notifications dropped without an OnDrop callback at
+// the Warn level.
+func WithClientLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
+func (c *Client) log() *slog.Logger {
+	if c.logger == nil {
+		return slog.Default()
+	}
+	return c.logger
+}
+
+func remoteAttr(addr string) slog.Attr {
+	return slog.String("remote_addr", addr)
+}
+
+func requestAttrs(info *RequestInfo, attrs ...slog.Attr) []slog.Attr {
+	return append([]slog.Attr{
+		slog.String("method", info.Method),
+		slog.Any("id", info.ID),
+		slog.String("remote_addr", info.RemoteAddr),
+	}, attrs...)
+}
+
+func (s *Server) logAccess(ctx context.Context, p *peer, req *request, rpcErr *Error, duration time.Duration) {
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.Any("id", req.ID),
+		remoteAttr(p.remoteAddr),
+		slog.Bool("notification", req.isNotification),
+		slog.Duration("duration", duration),
+	}
+	if rpcErr != nil {
+		attrs = append(attrs, slog.Int("code", rpcErr.Code))
+	} else {
+		attrs = append(attrs, slog.Int("code", 0))
+	}
+	if !s.redactParams && req.Params != nil {
+		attrs = append(attrs, slog.String("params", string(req.Params)))
+	}
+	s.log().LogAttrs(ctx, slog.LevelInfo, "jsonrpc: request", attrs...)
+}
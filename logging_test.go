@@ -0,0 +1,88 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	testcases := []struct {
+		name string
+		opts []ServerOption
+		req  string
+		logs []string
+	}{
+		{
+			name: "parse_error",
+			req:  `{"jsonrpc":"2.0","id":1,`,
+			logs: []string{`level=WARN msg="jsonrpc: parse error" remote_addr=192.0.2.1:1234`},
+		},
+		{
+			name: "invalid_request",
+			req:  `{"jsonrpc":"2.0","id":1}`,
+			logs: []string{`level=WARN msg="jsonrpc: invalid request" remote_addr=192.0.2.1:1234 id=1`},
+		},
+		{
+			name: "method_not_found",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"unknown"}`,
+			logs: []string{`level=DEBUG msg="jsonrpc: method not found" remote_addr=192.0.2.1:1234 method=unknown id=1`},
+		},
+		{
+			name: "handler_error",
+			opts: []ServerOption{WithHiddenInternalErrors()},
+			req:  `{"jsonrpc":"2.0","id":1,"method":"fail"}`,
+			logs: []string{`level=ERROR msg="jsonrpc: handler error" method=fail id=1 remote_addr=192.0.2.1:1234 error=secret`},
+		},
+		{
+			name: "notification_invalid_params",
+			req:  `{"jsonrpc":"2.0","method":"sum","params":1}`,
+			logs: []string{`level=WARN msg="jsonrpc: notification with invalid params" method=sum id=<nil> remote_addr=192.0.2.1:1234 error="jsonrpc: invalid params"`},
+		},
+		{
+			name: "access_log",
+			opts: []ServerOption{WithAccessLog()},
+			req:  `{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}}`,
+			logs: []string{`level=INFO msg="jsonrpc: request" method=sum id=1 remote_addr=192.0.2.1:1234 notification=false code=0 params="{\"A\":1,\"B\":2}"`},
+		},
+		{
+			name: "access_log_redacted",
+			opts: []ServerOption{WithAccessLog(), WithRedactedParams()},
+			req:  `{"jsonrpc":"2.0","id":1,"method":"unknown","params":{"password":"secret"}}`,
+			logs: []string{
+				`level=DEBUG msg="jsonrpc: method not found" remote_addr=192.0.2.1:1234 method=unknown id=1`,
+				`level=INFO msg="jsonrpc: request" method=unknown id=1 remote_addr=192.0.2.1:1234 notification=false code=-32601`,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+				Level: slog.LevelDebug,
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if a.Key == slog.TimeKey || a.Key == "duration" {
+						return slog.Attr{}
+					}
+					return a
+				},
+			}))
+			server := NewServer(append([]ServerOption{WithLogger(logger)}, tc.opts...)...)
+			server.HandleFunc("sum", sum)
+			server.HandleFunc("fail", func(ctx context.Context) (int, error) {
+				return 0, errors.New("secret")
+			})
+
+			req := httptest.NewRequest("POST", "localhost:8080", strings.NewReader(tc.req))
+			server.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got := strings.TrimSpace(buf.String()); got != strings.Join(tc.logs, "\n") {
+				t.Errorf("invalid logs: \ngot:\n%v\nwant:\n%v\n", got, strings.Join(tc.logs, "\n"))
+			}
+		})
+	}
+}
@@ -1,24 +1,62 @@
 package jsonrpc
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
+	"net/http"
+	"sync"
 )
 
 var (
 	errInvalidEncodedJSON    = errors.New("invalid encoded json")
 	errInvalidDecodedMessage = errors.New("invalid decoded message")
 	null                     = json.RawMessage([]byte("null"))
+	bufferPool               = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
 )
 
+// maxPooledBufferSize limits the size of the buffers kept in bufferPool, so a single large message doesn't pin memory.
+const maxPooledBufferSize = 64 << 10
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
 type rawMessage struct {
 	Version string          `json:"jsonrpc"`
 	ID      interface{}     `json:"id,omitempty"`
 	Method  string          `json:"method,omitempty"`
 	Params  json.RawMessage `json:"params,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
-	Error   *Error          `json:"error,omitempty"`
+	Error   *errorMessage   `json:"error,omitempty"`
+
+	// ProgressToken extends the request object, see OnProgress.
+	ProgressToken interface{} `json:"progressToken,omitempty"`
+}
+
+// responseMessage is the outgoing representation of a response. Unlike rawMessage,
+// its result is encoded in place instead of going through a json.RawMessage.
+type responseMessage struct {
+	Version string      `json:"jsonrpc"`
+	ID      interface{} `json:"id,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *Error      `json:"error,omitempty"`
+}
+
+// notificationMessage is the outgoing representation of a notification sent by a server.
+type notificationMessage struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
 }
 
 // request represents a JSON-RPC request received by a server or to be send by a client.
@@ -27,16 +65,37 @@ type request struct {
 	Method         string
 	Params         json.RawMessage
 	isNotification bool
+	header         http.Header           // headers set by the client interceptors
+	size           int                   // size of the encoded request, set when it is sent
+	subscription   *ClientSubscription   // registered when the response of a subscribe call is received
+	onNotification func(Notification)    // see OnNotification
+	onProgress     func(json.RawMessage) // see OnProgress
+	progressToken  interface{}
 }
 
-func (r *request) bytes() ([]byte, error) {
+// encode writes the JSON encoded representation of the request to w.
+func (r *request) encode(codec Codec, w io.Writer) error {
 	msg := rawMessage{
 		Version: "2.0",
 		ID:      r.ID,
 		Method:  r.Method,
 		Params:  r.Params,
+
+		ProgressToken: r.progressToken,
+	}
+	return codec.NewEncoder(w).Encode(msg)
+}
+
+// encodeRequests writes a single request, or a batch array when there is more than one.
+func encodeRequests(codec Codec, w io.Writer, reqs []*request) error {
+	if len(reqs) == 1 {
+		return reqs[0].encode(codec, w)
 	}
-	return json.Marshal(msg)
+	batch := make([]rawMessage, len(reqs))
+	for i, r := range reqs {
+		batch[i] = rawMessage{Version: "2.0", ID: r.ID, Method: r.Method, Params: r.Params, ProgressToken: r.progressToken}
+	}
+	return codec.NewEncoder(w).Encode(batch)
 }
 
 // Response represents the Response from a JSON-RPC request.
@@ -44,17 +103,48 @@ type Response struct {
 	id     interface{}
 	result json.RawMessage
 	error  *Error
+	codec  Codec
+	size   int // size of the encoded response
+
+	errorData  json.RawMessage                  // data of the error as received by the client
+	errorTypes map[int]func(*clientError) error // set by the client, see WithErrorType
 }
 
 func (r *Response) ID() interface{} {
 	return r.id
 }
 
+// Err returns the error of the Response, if any. Errors with a code registered
+// with WithErrorType are returned as their Go type.
 func (r *Response) Err() error {
 	if r.error == nil {
 		return nil
 	}
-	return r.error
+	codec := r.codec
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	err := &clientError{err: r.error, data: r.errorData, codec: codec}
+	if f, ok := r.errorTypes[r.error.Code]; ok {
+		return f(err)
+	}
+	return err
+}
+
+// setError sets the error of a response received by a client, its data is decoded with
+// the codec of the response.
+func (r *Response) setError(msg *errorMessage) error {
+	if msg == nil {
+		return nil
+	}
+	r.error = &Error{Code: msg.Code, Message: msg.Message}
+	if msg.Data != nil {
+		r.errorData = msg.Data
+		if err := r.codec.Unmarshal(msg.Data, &r.error.Data); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Decode will unmarshal the Response's result into v. If there was an error in the Response, that error will be returned.
@@ -62,21 +152,27 @@ func (r *Response) Decode(v interface{}) error {
 	if err := r.Err(); err != nil {
 		return err
 	}
-	if err := json.Unmarshal(r.result, v); err != nil {
+	codec := r.codec
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	if err := codec.Unmarshal(r.result, v); err != nil {
 		return err
 	}
 	return nil
 }
 
-// bytes returns the JSON encoded representation of the Response.
-func (r *Response) bytes() ([]byte, error) {
-	msg := rawMessage{
+// encode writes the JSON encoded representation of the Response to w.
+func (r *Response) encode(codec Codec, w io.Writer) error {
+	msg := responseMessage{
 		Version: "2.0",
 		ID:      r.id,
-		Result:  r.result,
 		Error:   r.error,
 	}
-	return json.Marshal(msg)
+	if r.error == nil {
+		msg.Result = r.result
+	}
+	return codec.NewEncoder(w).Encode(msg)
 }
 
 func errResponse(id interface{}, err *Error) *Response {
@@ -88,33 +184,37 @@ func errResponse(id interface{}, err *Error) *Response {
 	return resp
 }
 
-// decodeResponseFromReader decodes a JSON-encoded response from r and stores it in resp.
-func decodeResponseFromReader(r io.Reader, resp *Response) error {
+// decodeResponse decodes a JSON-encoded response from data and stores it in resp.
+func decodeResponse(codec Codec, data []byte, resp *Response) error {
 	msg := &rawMessage{}
-	if err := json.NewDecoder(r).Decode(msg); err != nil {
+	if err := codec.Unmarshal(data, msg); err != nil {
 		return errInvalidEncodedJSON
 	}
-	result, err := json.Marshal(msg.Result)
-	if err != nil || msg.Method != "" {
-		resp.id = msg.ID
+	resp.id = msg.ID
+	if msg.Method != "" {
 		return errInvalidDecodedMessage
 	}
 
-	resp.id = msg.ID
-	resp.result = result
-	resp.error = msg.Error
+	resp.result = msg.Result
+	if resp.result == nil {
+		resp.result = null
+	}
+	resp.codec = codec
+	if err := resp.setError(msg.Error); err != nil {
+		return errInvalidEncodedJSON
+	}
 
 	return nil
 }
 
-// decodeRequestFromReader decodes a JSON-encoded body and returns a request message.
-func decodeRequestFromReader(r io.Reader) (*request, error) {
+// decodeRequest decodes a JSON-encoded body and returns a request message.
+func decodeRequest(codec Codec, data []byte) (*request, error) {
 	msg := &rawMessage{}
-	if err := json.NewDecoder(r).Decode(msg); err != nil {
+	if err := codec.Unmarshal(data, msg); err != nil {
 		return nil, errInvalidEncodedJSON
 	}
 
-	req := &request{ID: msg.ID, Method: msg.Method, Params: msg.Params}
+	req := &request{ID: msg.ID, Method: msg.Method, Params: msg.Params, progressToken: msg.ProgressToken}
 	if msg.ID == nil {
 		req.isNotification = true
 	}
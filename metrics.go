@@ -0,0 +1,47 @@
+package jsonrpc
+
+import (
+	"time"
+)
+
+// MetricsRecorder records the requests handled by a Server or sent by a Client. It must
+// be safe for concurrent use. Requests of unknown methods are not recorded, so that
+// clients can't create an unbounded number of method labels.
+type MetricsRecorder interface {
+	// RequestStarted is called before a request is executed or sent.
+	RequestStarted(method string)
+	// RequestFinished is called with the outcome of every started request.
+	RequestFinished(m RequestMetrics)
+}
+
+// RequestMetrics describes the outcome of a request.
+type RequestMetrics struct {
+	Method       string
+	Notification bool
+	// Code is the code of the JSON-RPC error of the response, 0 if it succeeded.
+	Code int
+	// Err is the error that prevented the Client from getting a response, such as a
+	// transport error. It is always nil on the Server.
+	Err error
+	// Duration is the time spent in the handler and the interceptors on the Server, and
+	// the time spent sending the request and reading the response on the Client, retries included.
+	Duration time.Duration
+	// RequestSize and ResponseSize are the sizes in bytes of the encoded request and response,
+	// before compression. The ResponseSize of notifications is 0.
+	RequestSize  int
+	ResponseSize int
+}
+
+// WithServerMetrics records the requests handled by the Server with r.
+func WithServerMetrics(r MetricsRecorder) ServerOption {
+	return func(s *Server) {
+		s.metrics = r
+	}
+}
+
+// WithClientMetrics records the requests sent by the Client with r.
+func WithClientMetrics(r MetricsRecorder) ClientOption {
+	return func(c *Client) {
+		c.metrics = r
+	}
+}
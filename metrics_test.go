@@ -0,0 +1,151 @@
+package jsonrpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testRecorder struct {
+	mu       sync.Mutex
+	started  []string
+	finished []RequestMetrics
+}
+
+func (r *testRecorder) RequestStarted(method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = append(r.started, method)
+}
+
+func (r *testRecorder) RequestFinished(m RequestMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished = append(r.finished, m)
+}
+
+func TestMetrics(t *testing.T) {
+	srec, crec := &testRecorder{}, &testRecorder{}
+	server := NewServer(WithServerMetrics(srec))
+	server.HandleFunc("sum", sum)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewClient(ts.URL, WithClientMetrics(crec))
+
+	client.Call(context.Background(), "sum", Args{1, 2})
+	client.Call(context.Background(), "sum", nil)
+	client.Call(context.Background(), "unknown", nil)
+	client.Notify(context.Background(), "sum", Args{1, 2})
+
+	// the sizes are the ones of the messages exchanged, both sides must agree
+	testcases := []struct {
+		name     string
+		recorder *testRecorder
+		started  int
+		want     []RequestMetrics
+	}{
+		{
+			name:     "server",
+			recorder: srec,
+			started:  3,
+			want: []RequestMetrics{
+				{Method: "sum", RequestSize: 62, ResponseSize: 41},
+				{Method: "sum", Code: -32602, RequestSize: 53, ResponseSize: 75},
+				{Method: "sum", Notification: true, RequestSize: 55},
+			},
+		},
+		{
+			name:     "client",
+			recorder: crec,
+			started:  4,
+			want: []RequestMetrics{
+				{Method: "sum", RequestSize: 62, ResponseSize: 41},
+				{Method: "sum", Code: -32602, RequestSize: 53, ResponseSize: 75},
+				{Method: "unknown", Code: -32601, RequestSize: 57, ResponseSize: 77},
+				{Method: "sum", Notification: true, RequestSize: 55},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if len(tc.recorder.started) != tc.started {
+				t.Errorf("expected %v started requests, got %v", tc.started, tc.recorder.started)
+			}
+			if len(tc.recorder.finished) != len(tc.want) {
+				t.Fatalf("expected %v finished requests, got %v", len(tc.want), len(tc.recorder.finished))
+			}
+			for i, got := range tc.recorder.finished {
+				if got.Duration <= 0 {
+					t.Errorf("%v: invalid duration %v", i, got.Duration)
+				}
+				got.Duration = 0
+				if got != tc.want[i] {
+					t.Errorf("%v: invalid metrics: \ngot: %+v\nwant: %+v\n", i, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsHandlerPanic(t *testing.T) {
+	rec := &testRecorder{}
+	server := NewServer(WithServerMetrics(rec))
+	server.HandleFunc("panic", func(ctx context.Context) (int, error) {
+		panic("handler failed")
+	})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected the handler panic")
+			}
+		}()
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"panic"}`))
+		server.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+
+	if len(rec.started) != 1 || len(rec.finished) != 1 {
+		t.Fatalf("expected 1 started and finished request, got %v and %v", len(rec.started), len(rec.finished))
+	}
+	got := rec.finished[0]
+	got.Duration = 0
+	want := RequestMetrics{Method: "panic", Code: -32603, RequestSize: 41}
+	if got != want {
+		t.Errorf("invalid metrics: \ngot: %+v\nwant: %+v\n", got, want)
+	}
+}
+
+func TestMetricsAsyncNotify(t *testing.T) {
+	rec := &testRecorder{}
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewClient(ts.URL, WithClientMetrics(rec), WithAsyncNotify(AsyncNotify{Linger: 50 * time.Millisecond}))
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := client.Notify(context.Background(), "sum", Args{1, 2}); err != nil {
+			t.Fatalf("notify: error not expected: %v", err)
+		}
+	}
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: error not expected: %v", err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.started) != 3 || len(rec.finished) != 3 {
+		t.Fatalf("expected 3 started and finished requests, got %v and %v", len(rec.started), len(rec.finished))
+	}
+	for i, got := range rec.finished {
+		got.Duration = 0
+		want := RequestMetrics{Method: "sum", Notification: true, RequestSize: 55}
+		if got != want {
+			t.Errorf("%v: invalid metrics: \ngot: %+v\nwant: %+v\n", i, got, want)
+		}
+	}
+}
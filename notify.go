@@ -0,0 +1,267 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotifyQueueFull is reported when an asynchronous notification is dropped because the queue is full.
+	ErrNotifyQueueFull = errors.New("jsonrpc: notification queue full")
+	// ErrClientClosed is returned when notifying or flushing a closed Client.
+	ErrClientClosed = errors.New("jsonrpc: client closed")
+)
+
+// AsyncNotify configures the asynchronous mode of Client.Notify, see WithAsyncNotify.
+type AsyncNotify struct {
+	// QueueSize is the number of notifications waiting to be sent, the default is 1024.
+	QueueSize int
+	// MaxBatch is the maximum number of notifications sent in a single batch request,
+	// the default is 64. A MaxBatch of 1 sends every notification on its own.
+	MaxBatch int
+	// Linger is how long the sender waits for more notifications before sending a batch
+	// that isn't full. With no Linger only the notifications already queued are batched.
+	Linger time.Duration
+	// Timeout bounds the time spent sending each request, no limit by default.
+	Timeout time.Duration
+	// OnDrop is called with the notifications that were not delivered, either because
+	// the queue was full or because sending them failed. It is called by Notify or by the
+	// sender goroutine and must not block.
+	OnDrop func(DroppedNotification)
+}
+
+// DroppedNotification is a notification that was not delivered.
+type DroppedNotification struct {
+	Method string
+	Params json.RawMessage
+	Err    error
+}
+
+// WithAsyncNotify makes Client.Notify queue notifications and return immediately. A
+// background goroutine sends them, coalescing the notifications queued close together
+// into batch requests. Use Client.Flush to wait for the queued notifications to be sent
+// and Client.Close to stop the sender.
+func WithAsyncNotify(cfg AsyncNotify) ClientOption {
+	return func(c *Client) {
+		if cfg.QueueSize <= 0 {
+			cfg.QueueSize = 1024
+		}
+		if cfg.MaxBatch <= 0 {
+			cfg.MaxBatch = 64
+		}
+		c.notifier = &notifier{cfg: cfg}
+	}
+}
+
+// notifier sends the notifications queued by Client.Notify in the background.
+type notifier struct {
+	cfg    AsyncNotify
+	client *Client
+	queue  chan notification
+	done   chan struct{}
+
+	mu     sync.RWMutex // guards closed and the sends on queue
+	closed bool
+}
+
+// notification is a queued request, or a flush marker closed once the
+// notifications queued before it have been sent.
+type notification struct {
+	req     *request
+	flushed chan struct{}
+}
+
+func (n *notifier) start(c *Client) {
+	n.client = c
+	n.queue = make(chan notification, n.cfg.QueueSize)
+	n.done = make(chan struct{})
+	go n.run()
+}
+
+func (n *notifier) enqueue(req *request) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return ErrClientClosed
+	}
+	select {
+	case n.queue <- notification{req: req}:
+		return nil
+	default:
+		n.drop(req, ErrNotifyQueueFull)
+		return ErrNotifyQueueFull
+	}
+}
+
+func (n *notifier) flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	n.mu.RLock()
+	if n.closed {
+		n.mu.RUnlock()
+		return ErrClientClosed
+	}
+	select {
+	case n.queue <- notification{flushed: flushed}:
+		n.mu.RUnlock()
+	case <-ctx.Done():
+		n.mu.RUnlock()
+		return fmt.Errorf("jsonrpc: %v", ctx.Err())
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("jsonrpc: %v", ctx.Err())
+	}
+}
+
+func (n *notifier) close() {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+	<-n.done
+}
+
+// run sends the queued notifications until the queue is closed.
+func (n *notifier) run() {
+	defer close(n.done)
+	batch := make([]*request, 0, n.cfg.MaxBatch)
+	for item := range n.queue {
+		var flushed []chan struct{}
+		if item.flushed != nil {
+			flushed = append(flushed, item.flushed)
+		} else {
+			batch = append(batch, item.req)
+			flushed = n.collect(&batch, flushed)
+		}
+		if len(batch) > 0 {
+			n.send(batch)
+			batch = batch[:0]
+		}
+		for _, ch := range flushed {
+			close(ch)
+		}
+	}
+}
+
+// collect adds the queued notifications to batch until it is full, the queue is
+// empty once Linger expired, or a flush marker is found.
+func (n *notifier) collect(batch *[]*request, flushed []chan struct{}) []chan struct{} {
+	var timeout <-chan time.Time
+	if n.cfg.Linger > 0 {
+		timer := time.NewTimer(n.cfg.Linger)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for len(*batch) < n.cfg.MaxBatch {
+		var (
+			item notification
+			ok   bool
+		)
+		if timeout == nil {
+			select {
+			case item, ok = <-n.queue:
+			default:
+				return flushed
+			}
+		} else {
+			select {
+			case item, ok = <-n.queue:
+			case <-timeout:
+				return flushed
+			}
+		}
+		if !ok {
+			return flushed
+		}
+		if item.flushed != nil {
+			return append(flushed, item.flushed)
+		}
+		*batch = append(*batch, item.req)
+	}
+	return flushed
+}
+
+func (n *notifier) send(batch []*request) {
+	ctx := context.Background()
+	if n.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.cfg.Timeout)
+		defer cancel()
+	}
+	c := n.client
+	var start time.Time
+	if c.metrics != nil {
+		n.measure(batch)
+		for _, req := range batch {
+			c.metrics.RequestStarted(req.Method)
+		}
+		start = time.Now()
+	}
+	err := c.notify(ctx, batch...)
+	if c.metrics != nil {
+		for _, req := range batch {
+			c.record(req, start, nil, err)
+		}
+	}
+	if err != nil {
+		for _, req := range batch {
+			n.drop(req, err)
+		}
+	}
+}
+
+// measure sets the size of the notifications of a batch, which is only set by the
+// client when a request is sent on its own.
+func (n *notifier) measure(batch []*request) {
+	if len(batch) == 1 {
+		return
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for _, req := range batch {
+		buf.Reset()
+		if err := req.encode(n.client.codec, buf); err == nil {
+			req.size = buf.Len()
+		}
+	}
+}
+
+func (n *notifier) drop(req *request, err error) {
+	if n.cfg.OnDrop == nil {
+		n.client.log().LogAttrs(context.Background(), slog.LevelWarn, "jsonrpc: notification dropped", slog.String("method", req.Method), slog.Any("error", err))
+		return
+	}
+	n.cfg.OnDrop(DroppedNotification{Method: req.Method, Params: req.Params, Err: err})
+}
+
+// Flush waits until the notifications queued by Notify have been sent, it does
+// nothing unless the Client was created with WithAsyncNotify.
+func (c *Client) Flush(ctx context.Context) error {
+	if c.notifier == nil {
+		return nil
+	}
+	return c.notifier.flush(ctx)
+}
+
+// Close sends the queued notifications and stops the background sender started by
+// WithAsyncNotify. Notify returns ErrClientClosed once the Client is closed. The
+// connection of a Client created with NewConnClient is closed.
+func (c *Client) Close() error {
+	if c.notifier != nil {
+		c.notifier.close()
+	}
+	if c.conn != nil {
+		c.conn.close()
+		<-c.conn.done
+	}
+	return nil
+}
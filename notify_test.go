@@ -0,0 +1,151 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsyncNotify(t *testing.T) {
+	checkGoroutineLeaks(t)
+
+	var notifications, requests int64
+	server := NewServer()
+	server.HandleFunc("count", func(ctx context.Context, args Args) (int, error) {
+		atomic.AddInt64(&notifications, int64(args.A))
+		return 0, nil
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		server.ServeHTTP(rw, r)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithAsyncNotify(AsyncNotify{MaxBatch: 10, Linger: 50 * time.Millisecond}))
+	defer client.Close()
+	for i := 0; i < 100; i++ {
+		if err := client.Notify(context.Background(), "count", Args{A: 1}); err != nil {
+			t.Fatalf("notify: error not expected: %v", err)
+		}
+	}
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: error not expected: %v", err)
+	}
+	if got := atomic.LoadInt64(&notifications); got != 100 {
+		t.Errorf("expected 100 notifications, got %v", got)
+	}
+	if got := atomic.LoadInt64(&requests); got < 10 || got > 20 {
+		t.Errorf("expected notifications to be batched in 10 to 20 requests, got %v", got)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("close: error not expected: %v", err)
+	}
+	if err := client.Notify(context.Background(), "count", Args{A: 1}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+	if err := client.Flush(context.Background()); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestAsyncNotifyCloseSendsQueued(t *testing.T) {
+	var notifications int64
+	server := NewServer()
+	server.HandleFunc("count", func(ctx context.Context, args Args) (int, error) {
+		atomic.AddInt64(&notifications, int64(args.A))
+		return 0, nil
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithAsyncNotify(AsyncNotify{}))
+	for i := 0; i < 100; i++ {
+		client.Notify(context.Background(), "count", Args{A: 1})
+	}
+	client.Close()
+	if got := atomic.LoadInt64(&notifications); got != 100 {
+		t.Errorf("expected 100 notifications, got %v", got)
+	}
+}
+
+func TestAsyncNotifyDrop(t *testing.T) {
+	checkGoroutineLeaks(t)
+
+	unblock := make(chan struct{})
+	server := NewServer()
+	server.HandleFunc("block", func(ctx context.Context, args Args) (int, error) {
+		<-unblock
+		return 0, nil
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var dropped []DroppedNotification
+	client := NewClient(ts.URL, WithAsyncNotify(AsyncNotify{
+		QueueSize: 1,
+		MaxBatch:  1,
+		OnDrop: func(n DroppedNotification) {
+			mu.Lock()
+			defer mu.Unlock()
+			dropped = append(dropped, n)
+		},
+	}))
+
+	var full int
+	for i := 0; i < 10; i++ {
+		if err := client.Notify(context.Background(), "block", Args{A: i}); errors.Is(err, ErrNotifyQueueFull) {
+			full++
+		}
+	}
+	close(unblock)
+	client.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if full == 0 {
+		t.Fatal("expected notifications to be dropped")
+	}
+	if len(dropped) != full {
+		t.Errorf("expected %v dropped notifications, got %v", full, len(dropped))
+	}
+	for _, n := range dropped {
+		if n.Method != "block" || !errors.Is(n.Err, ErrNotifyQueueFull) {
+			t.Errorf("invalid dropped notification: %v %v", n.Method, n.Err)
+		}
+	}
+}
+
+func TestAsyncNotifySendError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	dropped := make(chan DroppedNotification, 2)
+	client := NewClient(ts.URL, WithAsyncNotify(AsyncNotify{
+		OnDrop: func(n DroppedNotification) { dropped <- n },
+	}))
+	client.Notify(context.Background(), "a", nil)
+	client.Notify(context.Background(), "b", nil)
+	client.Close()
+	close(dropped)
+
+	var methods []string
+	for n := range dropped {
+		var httpErr *HTTPError
+		if !errors.As(n.Err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected HTTPError 503, got %v", n.Err)
+		}
+		methods = append(methods, n.Method)
+	}
+	if len(methods) != 2 || methods[0] != "a" || methods[1] != "b" {
+		t.Errorf("expected a and b to be dropped, got %v", methods)
+	}
+}
@@ -0,0 +1,236 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OpenRPCVersion is the version of the OpenRPC specification implemented by Server.OpenRPC.
+const OpenRPCVersion = "1.2.6"
+
+// discoverMethod is the built-in method that returns the OpenRPC document of the server.
+const discoverMethod = "rpc.discover"
+
+// OpenRPCDocument describes a JSON-RPC server, see https://spec.open-rpc.org.
+type OpenRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       OpenRPCInfo       `json:"info"`
+	Methods    []OpenRPCMethod   `json:"methods"`
+	Components OpenRPCComponents `json:"components"`
+}
+
+// OpenRPCInfo holds the metadata of the API.
+type OpenRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenRPCMethod describes a registered method.
+type OpenRPCMethod struct {
+	Name           string                     `json:"name"`
+	Description    string                     `json:"description,omitempty"`
+	Params         []OpenRPCContentDescriptor `json:"params"`
+	Result         *OpenRPCContentDescriptor  `json:"result,omitempty"`
+	Errors         []*Error                   `json:"errors,omitempty"`
+	Examples       []OpenRPCExample           `json:"examples,omitempty"`
+	ParamStructure string                     `json:"paramStructure,omitempty"`
+}
+
+// OpenRPCContentDescriptor describes the params or the result of a method.
+type OpenRPCContentDescriptor struct {
+	Name     string  `json:"name"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// OpenRPCExample is an example of params and the result they produce.
+type OpenRPCExample struct {
+	Name   string                `json:"name"`
+	Params []OpenRPCExampleValue `json:"params"`
+	Result *OpenRPCExampleValue  `json:"result,omitempty"`
+}
+
+// OpenRPCExampleValue is a named example value.
+type OpenRPCExampleValue struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// OpenRPCComponents holds the schemas referenced by the methods.
+type OpenRPCComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// WithDescription sets the description of the method in the OpenRPC document.
+func WithDescription(description string) MethodOption {
+	return func(h *handlerType) {
+		h.description = description
+	}
+}
+
+// WithExample adds an example of params and result to the OpenRPC document.
+func WithExample(name string, params, result interface{}) MethodOption {
+	return func(h *handlerType) {
+		h.examples = append(h.examples, methodExample{name: name, params: params, result: result})
+	}
+}
+
+// WithErrors declares the application errors the method may return.
+func WithErrors(errs ...*Error) MethodOption {
+	return func(h *handlerType) {
+		h.errors = append(h.errors, errs...)
+	}
+}
+
+// withTypes sets the params and result types of a method registered with Handle.
+func withTypes(ptype, rtype reflect.Type) MethodOption {
+	return func(h *handlerType) {
+		h.ptype = ptype
+		h.rtype = rtype
+		if ptype != nil {
+			h.numArgs = 2
+		} else {
+			h.numArgs = 1
+		}
+	}
+}
+
+// WithServerInfo sets the title and version of the API in the OpenRPC document.
+func WithServerInfo(title, version string) ServerOption {
+	return func(s *Server) {
+		s.info = OpenRPCInfo{Title: title, Version: version}
+	}
+}
+
+type methodExample struct {
+	name   string
+	params interface{}
+	result interface{}
+}
+
+// OpenRPC returns the OpenRPC document of the server, derived from the registered methods.
+// Params and results are described with the JSON Schema of their Go types.
+func (s *Server) OpenRPC() *OpenRPCDocument {
+	s.init()
+	doc := &OpenRPCDocument{
+		OpenRPC:    OpenRPCVersion,
+		Info:       s.info,
+		Methods:    []OpenRPCMethod{},
+		Components: OpenRPCComponents{Schemas: map[string]*Schema{}},
+	}
+	s.handler.Range(func(key, value interface{}) bool {
+		name, htype := key.(string), value.(*handlerType)
+		if name != discoverMethod && name != cancelMethod {
+			doc.Methods = append(doc.Methods, s.describeMethod(name, htype, doc.Components.Schemas))
+		}
+		return true
+	})
+	sort.Slice(doc.Methods, func(i, j int) bool {
+		return doc.Methods[i].Name < doc.Methods[j].Name
+	})
+	return doc
+}
+
+func (s *Server) describeMethod(name string, htype *handlerType, defs map[string]*Schema) OpenRPCMethod {
+	m := OpenRPCMethod{
+		Name:        name,
+		Description: htype.description,
+		Params:      []OpenRPCContentDescriptor{},
+		Errors:      htype.errors,
+	}
+
+	for name, def := range htype.defs {
+		if _, ok := defs[name]; !ok {
+			defs[name] = def
+		}
+	}
+
+	// Struct params are sent by name, anything else is sent as a single value.
+	byName := false
+	if pschema := htype.paramsSchema; pschema != nil || htype.ptype != nil {
+		if pschema == nil {
+			pschema = schemaOf(htype.ptype, defs)
+		}
+		if ref := resolveSchema(pschema, defs); ref.Type == "object" && ref.Properties != nil {
+			byName = true
+			m.ParamStructure = "by-name"
+			for _, pname := range sortedKeys(ref.Properties) {
+				m.Params = append(m.Params, OpenRPCContentDescriptor{
+					Name:     pname,
+					Required: contains(ref.Required, pname),
+					Schema:   ref.Properties[pname],
+				})
+			}
+		} else {
+			m.Params = append(m.Params, OpenRPCContentDescriptor{Name: "params", Required: true, Schema: pschema})
+		}
+	}
+	if htype.resultSchema != nil {
+		m.Result = &OpenRPCContentDescriptor{Name: "result", Schema: htype.resultSchema}
+	} else if htype.rtype != nil {
+		m.Result = &OpenRPCContentDescriptor{Name: "result", Schema: schemaOf(htype.rtype, defs)}
+	} else {
+		m.Result = &OpenRPCContentDescriptor{Name: "result", Schema: &Schema{}}
+	}
+
+	for _, ex := range htype.examples {
+		example := OpenRPCExample{Name: ex.name, Params: []OpenRPCExampleValue{}}
+		if ex.params != nil {
+			example.Params = s.exampleParams(ex.params, byName)
+		}
+		if ex.result != nil {
+			example.Result = &OpenRPCExampleValue{Name: "result", Value: ex.result}
+		}
+		m.Examples = append(m.Examples, example)
+	}
+	return m
+}
+
+// exampleParams splits the example params into one value per param when they are sent by name.
+func (s *Server) exampleParams(params interface{}, byName bool) []OpenRPCExampleValue {
+	if byName {
+		var fields map[string]json.RawMessage
+		if b, err := s.codec.Marshal(params); err == nil && s.codec.Unmarshal(b, &fields) == nil {
+			values := make([]OpenRPCExampleValue, 0, len(fields))
+			for _, name := range sortedKeys(fields) {
+				values = append(values, OpenRPCExampleValue{Name: name, Value: fields[name]})
+			}
+			return values
+		}
+	}
+	return []OpenRPCExampleValue{{Name: "params", Value: params}}
+}
+
+// discover is the handler of the built-in rpc.discover method.
+func (s *Server) discover(ctx context.Context, params Params) (interface{}, error) {
+	return s.OpenRPC(), nil
+}
+
+// resolveSchema follows the $ref of a schema stored in defs.
+func resolveSchema(schema *Schema, defs map[string]*Schema) *Schema {
+	if ref, ok := defs[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]; ok && schema.Ref != "" {
+		return ref
+	}
+	return schema
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
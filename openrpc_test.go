@@ -0,0 +1,178 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type Node struct {
+	Value    int     `json:"value"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+type Embedded struct {
+	Created time.Time `json:"created"`
+}
+
+type Document struct {
+	Embedded
+	Title  string            `json:"title"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Data   []byte            `json:"data,omitempty"`
+	Ignore string            `json:"-"`
+	hidden string
+}
+
+var schemaTestcases = []struct {
+	name   string
+	v      interface{}
+	schema string
+	defs   string
+}{
+	{
+		name:   "int",
+		v:      0,
+		schema: `{"type":"integer"}`,
+		defs:   `{}`,
+	},
+	{
+		name:   "ptr_string_slice",
+		v:      &[]string{},
+		schema: `{"type":["array","null"],"items":{"type":"string"}}`,
+		defs:   `{}`,
+	},
+	{
+		name:   "recursive_struct",
+		v:      Node{},
+		schema: `{"$ref":"#/components/schemas/github.com_echovl_jsonrpc.Node"}`,
+		defs:   `{"github.com_echovl_jsonrpc.Node":{"type":"object","properties":{"children":{"type":["array","null"],"items":{"oneOf":[{"$ref":"#/components/schemas/github.com_echovl_jsonrpc.Node"},{"type":"null"}]}},"value":{"type":"integer"}},"required":["value"]}}`,
+	},
+	{
+		name:   "embedded_struct",
+		v:      Document{},
+		schema: `{"$ref":"#/components/schemas/github.com_echovl_jsonrpc.Document"}`,
+		defs:   `{"github.com_echovl_jsonrpc.Document":{"type":"object","properties":{"created":{"type":"string","format":"date-time"},"data":{"type":["string","null"],"format":"byte"},"tags":{"type":["object","null"],"additionalProperties":{"type":"string"}},"title":{"type":"string"}},"required":["created","title"]}}`,
+	},
+}
+
+func TestSchemaOf(t *testing.T) {
+	for _, tc := range schemaTestcases {
+		t.Run(tc.name, func(t *testing.T) {
+			defs := map[string]*Schema{}
+			schema, _ := json.Marshal(schemaOf(reflect.TypeOf(tc.v), defs))
+			if string(schema) != tc.schema {
+				t.Errorf("invalid schema: \ngot: %s\nwant: %v\n", schema, tc.schema)
+			}
+			b, _ := json.Marshal(defs)
+			if string(b) != tc.defs {
+				t.Errorf("invalid schema definitions: \ngot: %s\nwant: %v\n", b, tc.defs)
+			}
+		})
+	}
+}
+
+type Cookie struct {
+	Name string
+}
+
+type Page[T any] struct {
+	Items []T
+}
+
+func TestSchemaDefNames(t *testing.T) {
+	type Defs struct {
+		Local Cookie
+		HTTP  http.Cookie
+		Page  Page[Cookie]
+	}
+	defs := map[string]*Schema{}
+	schemaOf(reflect.TypeOf(Defs{}), defs)
+
+	want := []string{
+		"github.com_echovl_jsonrpc.Cookie",
+		"github.com_echovl_jsonrpc.Defs",
+		"github.com_echovl_jsonrpc.Page_github.com_echovl_jsonrpc.Cookie_",
+		"net_http.Cookie",
+	}
+	var names []string
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if got := mustMarshal(names); got != mustMarshal(want) {
+		t.Errorf("invalid definition names: \ngot:  %v\nwant: %v", got, mustMarshal(want))
+	}
+	if props := defs["net_http.Cookie"].Properties; props["Domain"] == nil {
+		t.Errorf("http.Cookie definition overwritten: %v", mustMarshal(defs["net_http.Cookie"]))
+	}
+}
+
+func TestOpenRPC(t *testing.T) {
+	errOverflow := &Error{Code: 1, Message: "Overflow"}
+	server := NewServer(WithServerInfo("Calculator", "2.0.0"))
+	server.HandleFunc("sum", sum,
+		WithDescription("Adds two numbers."),
+		WithExample("one_plus_two", Args{1, 2}, Reply{3}),
+		WithErrors(errOverflow),
+	)
+	HandleNoParams(server, "random", random)
+
+	req := httptest.NewRequest("POST", "locahost:8080", bytes.NewReader([]byte(`{"jsonrpc":"2.0","id":1,"method":"rpc.discover"}`)))
+	rw := httptest.NewRecorder()
+	server.ServeHTTP(rw, req)
+
+	resp := &Response{}
+	if err := decodeResponse(DefaultCodec, rw.Body.Bytes(), resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	doc := &OpenRPCDocument{}
+	if err := resp.Decode(doc); err != nil {
+		t.Fatalf("rpc.discover: error not expected: %v", err)
+	}
+
+	if doc.OpenRPC != OpenRPCVersion || doc.Info != (OpenRPCInfo{"Calculator", "2.0.0"}) {
+		t.Errorf("invalid document header: %v %v", doc.OpenRPC, doc.Info)
+	}
+	if len(doc.Methods) != 2 || doc.Methods[0].Name != "random" || doc.Methods[1].Name != "sum" {
+		t.Fatalf("invalid methods: %+v", doc.Methods)
+	}
+
+	got, _ := json.Marshal(doc.Methods[1])
+	want := `{"name":"sum","description":"Adds two numbers.",` +
+		`"params":[{"name":"A","required":true,"schema":{"type":"integer"}},{"name":"B","required":true,"schema":{"type":"integer"}}],` +
+		`"result":{"name":"result","schema":{"$ref":"#/components/schemas/github.com_echovl_jsonrpc.Reply"}},` +
+		`"errors":[{"code":1,"message":"Overflow"}],` +
+		`"examples":[{"name":"one_plus_two","params":[{"name":"A","value":1},{"name":"B","value":2}],"result":{"name":"result","value":{"C":3}}}],` +
+		`"paramStructure":"by-name"}`
+	if string(got) != want {
+		t.Errorf("invalid sum method: \ngot: %s\nwant: %v\n", got, want)
+	}
+	if _, ok := doc.Components.Schemas["github.com_echovl_jsonrpc.Reply"]; !ok {
+		t.Errorf("Reply schema not found in components")
+	}
+}
+
+func TestOpenRPCMethods(t *testing.T) {
+	server := NewServer()
+	server.Handle("raw", HandlerFunc(func(ctx context.Context, params Params) (interface{}, error) {
+		return nil, nil
+	}))
+	server.HandleFunc("echo", func(ctx context.Context, s string) (string, error) {
+		return s, nil
+	})
+
+	doc := server.OpenRPC()
+	got, _ := json.Marshal(doc.Methods)
+	want := `[{"name":"echo","params":[{"name":"params","required":true,"schema":{"type":"string"}}],"result":{"name":"result","schema":{"type":"string"}}},` +
+		`{"name":"raw","params":[],"result":{"name":"result","schema":{}}}]`
+	if string(got) != want {
+		t.Errorf("invalid methods: \ngot: %s\nwant: %v\n", got, want)
+	}
+}
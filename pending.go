@@ -0,0 +1,47 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+)
+
+// PendingCall is a call started by Client.Go.
+type PendingCall struct {
+	Method string
+	ID     interface{} // id of the request, allocated like the ids of Client.Call
+
+	done chan struct{}
+	resp *Response
+	err  error
+}
+
+// Done returns a channel that is closed when the call completes.
+func (p *PendingCall) Done() <-chan struct{} {
+	return p.done
+}
+
+// Result waits for the call to complete and returns the same response and error as Client.Call.
+func (p *PendingCall) Result() (*Response, error) {
+	<-p.done
+	return p.resp, p.err
+}
+
+// Go executes the named method asynchronously and returns a PendingCall that completes
+// when the response is received. Canceling ctx aborts the call. Many calls can be
+// started at once and gathered by selecting on their Done channels.
+func (c *Client) Go(ctx context.Context, method string, params interface{}, opts ...CallOption) *PendingCall {
+	call := &PendingCall{Method: method, done: make(chan struct{})}
+	p, err := c.codec.Marshal(params)
+	if err != nil {
+		call.err = fmt.Errorf("jsonrpc: marshaling params: %w", err)
+		close(call.done)
+		return call
+	}
+	req := newRequest(c.nextID(), method, p, opts)
+	call.ID = req.ID
+	go func() {
+		defer close(call.done)
+		call.resp, call.err = c.doCall(ctx, req)
+	}()
+	return call
+}
@@ -0,0 +1,85 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGo(t *testing.T) {
+	checkGoroutineLeaks(t)
+
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+
+	calls := make([]*PendingCall, 10)
+	for i := range calls {
+		calls[i] = client.Go(context.Background(), "sum", Args{A: i, B: 1})
+	}
+	ids := map[interface{}]bool{}
+	for i, call := range calls {
+		select {
+		case <-call.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("call %v not completed", i)
+		}
+		resp, err := call.Result()
+		if err != nil {
+			t.Fatalf("sum: error not expected: %v", err)
+		}
+		reply := &Reply{}
+		if err := resp.Decode(reply); err != nil {
+			t.Fatalf("sum: error not expected: %v", err)
+		}
+		if reply.C != i+1 {
+			t.Errorf("sum: expected %v, got %v", i+1, reply.C)
+		}
+		if fmt.Sprint(resp.id) != fmt.Sprint(call.ID) {
+			t.Errorf("expected response id %v, got %v", call.ID, resp.id)
+		}
+		ids[call.ID] = true
+	}
+	if len(ids) != len(calls) {
+		t.Errorf("expected %v distinct ids, got %v", len(calls), len(ids))
+	}
+}
+
+func TestGoCancel(t *testing.T) {
+	checkGoroutineLeaks(t)
+
+	server := NewServer()
+	server.HandleFunc("block", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	call := client.Go(ctx, "block", nil)
+	select {
+	case <-call.Done():
+		t.Fatal("call completed before being canceled")
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	if _, err := call.Result(); err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("expected context canceled error, got %v", err)
+	}
+}
+
+func TestGoMarshalError(t *testing.T) {
+	client := NewClient("http://localhost")
+	call := client.Go(context.Background(), "sum", make(chan int))
+	<-call.Done()
+	if _, err := call.Result(); err == nil {
+		t.Error("expected marshaling error")
+	}
+}
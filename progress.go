@@ -0,0 +1,97 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// progressMethod is the notification reporting the progress of a request, as in the
+// Language Server Protocol: {"method":"$/progress","params":{"token":1,"value":...}}.
+const progressMethod = "$/progress"
+
+type progressKey struct{}
+
+// progressParams are the params of a $/progress notification.
+type progressParams struct {
+	Token interface{} `json:"token"`
+	Value interface{} `json:"value"`
+}
+
+// progress reports the progress of a request to its client.
+type progress struct {
+	token  interface{}
+	notify func(method string, params interface{}) error
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// ReportProgress sends v to the client of the request handled with ctx, in a $/progress
+// notification holding the progress token of the request. Clients ask for the progress of
+// a request by sending a progress token with it, see OnProgress. The notifications are
+// sent over connections and, over HTTP, as Server-Sent Events before the response. It
+// does nothing if the client didn't ask for the progress of the request, and returns
+// ErrStreamClosed once the response is sent.
+func ReportProgress(ctx context.Context, v interface{}) error {
+	p, ok := ctx.Value(progressKey{}).(*progress)
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrStreamClosed
+	}
+	return p.notify(progressMethod, progressParams{Token: p.token, Value: v})
+}
+
+func (p *progress) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+}
+
+// withProgress returns the context of a request whose client asked for its progress.
+// done must be called before the response is sent.
+func (s *Server) withProgress(ctx context.Context, req *request) (context.Context, func()) {
+	if req.progressToken == nil || req.isNotification {
+		return ctx, func() {}
+	}
+	p := &progress{token: req.progressToken}
+	if msg, ok := ctx.Value(connKey{}).(*connMessage); ok {
+		p.notify = msg.conn.notify
+	} else if stream, ok := StreamFromContext(ctx); ok {
+		p.notify = stream.Notify
+	} else {
+		return ctx, func() {}
+	}
+	return context.WithValue(ctx, progressKey{}, p), p.close
+}
+
+// OnProgress asks the server for the progress of the call and calls f with the values
+// passed to ReportProgress by the handler. The request carries a progress token, the id
+// of the call, in its "progressToken" member. f must not block: over HTTP it is called
+// by the goroutine of the call, on a connection by the goroutine reading the connection.
+func OnProgress(f func(value json.RawMessage)) CallOption {
+	return func(r *request) {
+		r.onProgress = f
+	}
+}
+
+// progress passes the value of a $/progress notification to the callback of req, and
+// reports whether the notification was for req.
+func (r *request) progress(codec Codec, params json.RawMessage) bool {
+	if r.onProgress == nil {
+		return false
+	}
+	var p struct {
+		Token interface{}     `json:"token"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := codec.Unmarshal(params, &p); err != nil || callKey(p.Token) != callKey(r.progressToken) {
+		return false
+	}
+	r.onProgress(p.Value)
+	return true
+}
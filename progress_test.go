@@ -0,0 +1,174 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newProgressServer returns a server whose "import" method reports its progress with ReportProgress.
+func newProgressServer(reports chan<- context.Context) *Server {
+	server := NewServer()
+	server.HandleFunc("import", func(ctx context.Context, args ImportArgs) (string, error) {
+		for i := 1; i <= args.Items; i++ {
+			if err := ReportProgress(ctx, map[string]int{"done": i, "total": args.Items}); err != nil {
+				return "", err
+			}
+		}
+		if reports != nil {
+			reports <- ctx
+		}
+		return "imported", nil
+	})
+	return server
+}
+
+func TestProgress(t *testing.T) {
+	testcases := []struct {
+		name string
+		req  string
+		resp string
+	}{
+		{
+			name: "progress",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"import","params":{"Items":2},"progressToken":"import-1"}`,
+			resp: `{"jsonrpc":"2.0","method":"$/progress","params":{"token":"import-1","value":{"done":1,"total":2}}}` + "\n" +
+				`{"jsonrpc":"2.0","method":"$/progress","params":{"token":"import-1","value":{"done":2,"total":2}}}` + "\n" +
+				`{"jsonrpc":"2.0","id":1,"result":"imported"}` + "\n",
+		},
+		{
+			name: "no_token",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"import","params":{"Items":2}}`,
+			resp: `{"jsonrpc":"2.0","id":1,"result":"imported"}` + "\n",
+		},
+		{
+			name: "batch",
+			req:  `[{"jsonrpc":"2.0","id":1,"method":"import","params":{"Items":1},"progressToken":2}]`,
+			resp: `{"jsonrpc":"2.0","method":"$/progress","params":{"token":2,"value":{"done":1,"total":1}}}` + "\n" +
+				`[{"jsonrpc":"2.0","id":1,"result":"imported"}]` + "\n",
+		},
+	}
+
+	conn := serveConn(t, context.Background(), newProgressServer(nil))
+	r := bufio.NewReader(conn)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := conn.Write([]byte(tc.req + "\n")); err != nil {
+				t.Fatalf("error not expected: %v", err)
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var resp string
+			for n := strings.Count(tc.resp, "\n"); n > 0; n-- {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					t.Fatalf("error not expected: %v", err)
+				}
+				resp += line
+			}
+			if resp != tc.resp {
+				t.Errorf("invalid response: \ngot:\n%v\nwant:\n%v", resp, tc.resp)
+			}
+		})
+	}
+}
+
+func TestProgressHTTP(t *testing.T) {
+	req := httptest.NewRequest("POST", "localhost:8080", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"import","params":{"Items":1},"progressToken":1}`))
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	rw := httptest.NewRecorder()
+	newProgressServer(nil).ServeHTTP(rw, req)
+
+	want := `data: {"jsonrpc":"2.0","method":"$/progress","params":{"token":1,"value":{"done":1,"total":1}}}` + "\n\n" +
+		`data: {"jsonrpc":"2.0","id":1,"result":"imported"}` + "\n\n"
+	if body := rw.Body.String(); body != want {
+		t.Errorf("invalid body: \ngot:\n%v\nwant:\n%v", body, want)
+	}
+}
+
+func TestProgressClient(t *testing.T) {
+	reports := make(chan context.Context, 1)
+	server := newProgressServer(reports)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	clients := map[string]*Client{
+		"http": NewClient(ts.URL),
+		"conn": NewConnClient(serveConn(t, context.Background(), server)),
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			defer client.Close()
+
+			var progress, notifications []string
+			resp, err := client.Call(context.Background(), "import", ImportArgs{Items: 2},
+				OnProgress(func(value json.RawMessage) {
+					progress = append(progress, string(value))
+				}),
+				OnNotification(func(n Notification) {
+					notifications = append(notifications, n.Method)
+				}))
+			if err != nil {
+				t.Fatalf("import: error not expected: %v", err)
+			}
+			var result string
+			if err := resp.Decode(&result); err != nil || result != "imported" {
+				t.Errorf("import: expected imported, got %v (%v)", result, err)
+			}
+			want := []string{`{"done":1,"total":2}`, `{"done":2,"total":2}`}
+			if got := mustMarshal(progress); got != mustMarshal(want) {
+				t.Errorf("invalid progress: \ngot:  %v\nwant: %v", progress, want)
+			}
+			if len(notifications) != 0 {
+				t.Errorf("progress passed to OnNotification: %v", notifications)
+			}
+			if err := ReportProgress(<-reports, nil); err != ErrStreamClosed {
+				t.Errorf("expected %v, got %v", ErrStreamClosed, err)
+			}
+
+			// without OnProgress the progress isn't reported
+			if _, err := client.Call(context.Background(), "import", ImportArgs{Items: 2}); err != nil {
+				t.Fatalf("import: error not expected: %v", err)
+			}
+			if err := ReportProgress(<-reports, nil); err != nil {
+				t.Errorf("error not expected: %v", err)
+			}
+		})
+	}
+}
+
+func TestProgressLargeIDs(t *testing.T) {
+	server := newProgressServer(nil)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	clients := map[string]*Client{
+		"http": NewClient(ts.URL),
+		"conn": NewConnClient(serveConn(t, context.Background(), server)),
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			defer client.Close()
+			client.next = 999_999
+
+			// the ids and progress tokens 1000000 and 1000001 are sent
+			for i := 0; i < 2; i++ {
+				var progress []string
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				_, err := client.Call(ctx, "import", ImportArgs{Items: 1}, OnProgress(func(value json.RawMessage) {
+					progress = append(progress, string(value))
+				}))
+				cancel()
+				if err != nil {
+					t.Fatalf("import %v: error not expected: %v", client.next, err)
+				}
+				if want := []string{`{"done":1,"total":1}`}; mustMarshal(progress) != mustMarshal(want) {
+					t.Errorf("import %v: invalid progress: \ngot:  %v\nwant: %v", client.next, progress, want)
+				}
+			}
+		})
+	}
+}
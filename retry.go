@@ -0,0 +1,112 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures how a Client retries calls to idempotent methods.
+// Calls are retried on transport errors, on HTTP 5xx and 429 responses and on
+// the JSON-RPC error codes listed in RetryCodes. Notifications are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, it grows by Multiplier up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes each delay by up to this fraction of it, in [0, 1].
+	Jitter float64
+	// RetryCodes are the JSON-RPC error codes that are retried.
+	RetryCodes []int
+	// Idempotent lists the methods that are safe to retry, no other method is retried.
+	Idempotent []string
+	// OnRetry, if set, is called before waiting for each retry.
+	OnRetry func(RetryEvent)
+}
+
+// RetryEvent describes a failed attempt that is about to be retried.
+type RetryEvent struct {
+	Method  string
+	Attempt int // number of the failed attempt, starting at 1
+	// Err is the error of the attempt: the transport error, or an *HTTPError when the
+	// response isn't JSON, such as a 503 from a proxy. It is nil when the server answered
+	// with a JSON response carrying a retryable status or error code.
+	Err   error
+	Delay time.Duration // time to wait before the next attempt
+}
+
+// DefaultRetryPolicy returns a policy of 3 attempts with an exponential backoff
+// starting at 100ms, for the given idempotent methods.
+func DefaultRetryPolicy(idempotent ...string) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Idempotent:     idempotent,
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed calls, by default calls are attempted once.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = &policy
+	}
+}
+
+// shouldRetry reports whether the attempt failed in a retryable way and there are attempts left.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, method string, attempt, status int, resp *Response, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !contains(p.Idempotent, method) {
+		return false
+	}
+	switch {
+	case err != nil && status == 0:
+		// transport error
+		return true
+	case isUnavailableStatus(status):
+		return true
+	case err == nil && resp.error != nil:
+		for _, code := range p.RetryCodes {
+			if resp.error.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wait sleeps before the next attempt, it returns early if ctx is done.
+func (p *RetryPolicy) wait(ctx context.Context, method string, attempt int, err error) error {
+	delay := p.backoff(attempt)
+	if p.OnRetry != nil {
+		p.OnRetry(RetryEvent{Method: method, Attempt: attempt, Err: err, Delay: delay})
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("jsonrpc: %v", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,128 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyHandler fails the first failures requests with the given status before serving them.
+func flakyHandler(server http.Handler, failures int64, status int) (http.Handler, *int64) {
+	var requests int64
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= failures {
+			rw.WriteHeader(status)
+			rw.Write([]byte("<html>unavailable</html>"))
+			return
+		}
+		server.ServeHTTP(rw, r)
+	}), &requests
+}
+
+func TestRetry(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+	var busy int64
+	server.HandleFunc("busy", func(ctx context.Context) (int, error) {
+		if atomic.AddInt64(&busy, 1) == 1 {
+			return 0, &Error{Code: 7, Message: "Busy"}
+		}
+		return 1, nil
+	})
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Multiplier:     2,
+		RetryCodes:     []int{7},
+		Idempotent:     []string{"sum", "busy"},
+	}
+
+	testcases := []struct {
+		name     string
+		method   string
+		failures int64
+		status   int
+		attempts int64
+		err      bool
+	}{
+		{name: "unavailable", method: "sum", failures: 2, status: http.StatusServiceUnavailable, attempts: 3},
+		{name: "too_many_requests", method: "sum", failures: 1, status: http.StatusTooManyRequests, attempts: 2},
+		{name: "max_attempts", method: "sum", failures: 3, status: http.StatusBadGateway, attempts: 3, err: true},
+		{name: "not_idempotent", method: "charge", failures: 1, status: http.StatusBadGateway, attempts: 1, err: true},
+		{name: "client_error", method: "sum", failures: 1, status: http.StatusBadRequest, attempts: 1, err: true},
+		{name: "retry_code", method: "busy", attempts: 2},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, requests := flakyHandler(server, tc.failures, tc.status)
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			var events []RetryEvent
+			p := policy
+			p.OnRetry = func(e RetryEvent) {
+				events = append(events, e)
+			}
+			client := NewClient(ts.URL, WithRetryPolicy(p))
+			_, err := client.Call(context.Background(), tc.method, Args{1, 2})
+			if (err != nil) != tc.err {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if *requests != tc.attempts {
+				t.Errorf("invalid number of attempts:\ngot: %v\nwant: %v", *requests, tc.attempts)
+			}
+			if int64(len(events)) != tc.attempts-1 {
+				t.Errorf("invalid number of retry events:\ngot: %v\nwant: %v", len(events), tc.attempts-1)
+			}
+			for i, e := range events {
+				if e.Attempt != i+1 || e.Method != tc.method {
+					t.Errorf("invalid retry event: %+v", e)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	h, requests := flakyHandler(NewServer(), 10, http.StatusServiceUnavailable)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewClient(ts.URL, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: time.Hour,
+		Idempotent:     []string{"sum"},
+		OnRetry: func(RetryEvent) {
+			cancel()
+		},
+	}))
+	_, err := client.Call(ctx, "sum", Args{1, 2})
+	if !errors.Is(ctx.Err(), context.Canceled) || err == nil {
+		t.Errorf("expected context canceled error, got %v", err)
+	}
+	if *requests != 1 {
+		t.Errorf("invalid number of attempts:\ngot: %v\nwant: 1", *requests)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if got := p.backoff(attempt + 1); got != want*time.Millisecond {
+			t.Errorf("attempt %v: invalid backoff:\ngot: %v\nwant: %v", attempt+1, got, want*time.Millisecond)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("backoff out of the jitter range: %v", got)
+		}
+	}
+}
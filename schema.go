@@ -0,0 +1,559 @@
+package jsonrpc
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema used to describe and validate the params and results of a method.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Nullable             bool               `json:"-"` // also accepts null, see MarshalJSON
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// schemaFields has the fields of Schema without its methods.
+type schemaFields Schema
+
+// nullSchema is the schema of the null value.
+var nullSchema = json.RawMessage(`{"type":"null"}`)
+
+// MarshalJSON implements json.Marshaler. A Nullable schema is encoded with the null
+// type added to its type, {"type":["string","null"]}, or, when it is a reference, as
+// {"oneOf":[{"$ref":...},{"type":"null"}]}.
+func (s Schema) MarshalJSON() ([]byte, error) {
+	switch {
+	case !s.Nullable || s.Ref == "" && s.Type == "":
+		// without a type every value, null included, is accepted
+		return json.Marshal(schemaFields(s))
+	case s.Ref != "":
+		s.Nullable = false
+		return json.Marshal(struct {
+			OneOf []interface{} `json:"oneOf"`
+		}{[]interface{}{s, nullSchema}})
+	}
+	return json.Marshal(struct {
+		Type []string `json:"type"`
+		schemaFields
+	}{[]string{s.Type, "null"}, schemaFields(s)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, it decodes the encodings of MarshalJSON.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Type  json.RawMessage   `json:"type"`
+		OneOf []json.RawMessage `json:"oneOf"`
+		*schemaFields
+	}
+	aux.schemaFields = (*schemaFields)(s)
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(aux.OneOf) == 2 && string(aux.OneOf[1]) == string(nullSchema) {
+		if err := json.Unmarshal(aux.OneOf[0], s); err != nil {
+			return err
+		}
+		s.Nullable = true
+		return nil
+	}
+	if len(aux.Type) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(aux.Type, &s.Type); err == nil {
+		return nil
+	}
+	var types []string
+	if err := json.Unmarshal(aux.Type, &types); err != nil {
+		return err
+	}
+	for _, t := range types {
+		if t == "null" {
+			s.Nullable = true
+		} else {
+			s.Type = t
+		}
+	}
+	return nil
+}
+
+// SchemaError reports a value that doesn't match its schema. A list of them is
+// sent in the Data of ErrInvalidParams when the params of a request are rejected.
+type SchemaError struct {
+	Path    string `json:"path"` // JSON pointer to the invalid value
+	Message string `json:"message"`
+}
+
+// Error returns the string representation of the error.
+func (e SchemaError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+var (
+	typeOfTime            = reflect.TypeOf(time.Time{})
+	typeOfRawMessage      = reflect.TypeOf(json.RawMessage{})
+	typeOfJSONMarshaler   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	typeOfTextMarshaler   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	schemaRefPrefix       = "#/components/schemas/"
+	schemaTypeOfPrimitive = map[reflect.Kind]string{
+		reflect.Bool:    "boolean",
+		reflect.Int:     "integer",
+		reflect.Int8:    "integer",
+		reflect.Int16:   "integer",
+		reflect.Int32:   "integer",
+		reflect.Int64:   "integer",
+		reflect.Uint:    "integer",
+		reflect.Uint8:   "integer",
+		reflect.Uint16:  "integer",
+		reflect.Uint32:  "integer",
+		reflect.Uint64:  "integer",
+		reflect.Float32: "number",
+		reflect.Float64: "number",
+		reflect.String:  "string",
+	}
+)
+
+// schemaOf derives the JSON Schema of t following the encoding/json rules. Named
+// struct types are stored in defs and referenced with $ref, so recursive types are supported.
+func schemaOf(t reflect.Type, defs map[string]*Schema) *Schema {
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		// encoding/json encodes nil pointers, slices and maps as null.
+		s := nonNullSchemaOf(t, defs)
+		s.Nullable = true
+		return s
+	}
+	return nonNullSchemaOf(t, defs)
+}
+
+func nonNullSchemaOf(t reflect.Type, defs map[string]*Schema) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == typeOfTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == typeOfRawMessage:
+		return &Schema{}
+	case t.Implements(typeOfJSONMarshaler) || reflect.PtrTo(t).Implements(typeOfJSONMarshaler):
+		// The encoding is defined by the type itself.
+		return &Schema{}
+	case t.Implements(typeOfTextMarshaler) || reflect.PtrTo(t).Implements(typeOfTextMarshaler):
+		return &Schema{Type: "string"}
+	}
+
+	if typ, ok := schemaTypeOfPrimitive[t.Kind()]; ok {
+		switch t.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return &Schema{Type: typ, Minimum: new(float64)}
+		}
+		return &Schema{Type: typ}
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), defs)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), defs)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, defs)
+		}
+		name := defName(t)
+		if _, ok := defs[name]; !ok {
+			// Reserve the name before walking the fields to stop the recursion.
+			defs[name] = &Schema{}
+			*defs[name] = *structSchema(t, defs)
+		}
+		return &Schema{Ref: schemaRefPrefix + name}
+	default:
+		// interface{} and any other type accept any value.
+		return &Schema{}
+	}
+}
+
+// defName returns the name of the definition of a named type, qualified by its package
+// path so the types of different packages don't collide. The characters not allowed in
+// the component names of OpenRPC, such as the slashes of the path and the brackets of
+// generic types, are replaced with underscores.
+func defName(t reflect.Type) string {
+	name := t.Name()
+	if t.PkgPath() != "" {
+		name = t.PkgPath() + "." + name
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func structSchema(t reflect.Type, defs map[string]*Schema) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitempty, quoted, ok := jsonField(f)
+		if !ok {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.PkgPath != "" && ft.Kind() != reflect.Struct {
+			continue
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			// Fields of embedded structs are promoted to the outer object.
+			embedded := structSchema(ft, defs)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if quoted && quotable(f.Type) {
+			// The ",string" option encodes scalars inside a JSON string.
+			s.Properties[name] = &Schema{Type: "string", Nullable: f.Type.Kind() == reflect.Ptr}
+		} else {
+			s.Properties[name] = schemaOf(f.Type, defs)
+		}
+		if !omitempty {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// jsonField returns the JSON name of a struct field, its omitempty and string options
+// and whether it is encoded at all.
+func jsonField(f reflect.StructField) (name string, omitempty, quoted bool, ok bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false, false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false, false
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			omitempty = true
+		case "string":
+			quoted = true
+		}
+	}
+	return parts[0], omitempty, quoted, true
+}
+
+// quotable reports whether encoding/json applies the ",string" option to a field of
+// type t: booleans, numbers and strings, or an unnamed pointer to one of them.
+func quotable(t reflect.Type) bool {
+	if t.Name() == "" && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	_, ok := schemaTypeOfPrimitive[t.Kind()]
+	return ok
+}
+
+// patterns caches the compiled Schema.Pattern expressions.
+var patterns sync.Map
+
+// compilePattern compiles and caches a Schema.Pattern expression.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("jsonrpc: invalid schema pattern %q: %w", pattern, err)
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// compile compiles the patterns of the schema and of its subschemas, so an invalid
+// expression is reported when the method is registered.
+func (s *Schema) compile() error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		if _, err := compilePattern(s.Pattern); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(s.Properties) {
+		if err := s.Properties[name].compile(); err != nil {
+			return err
+		}
+	}
+	if err := s.Items.compile(); err != nil {
+		return err
+	}
+	return s.AdditionalProperties.compile()
+}
+
+// Validate checks that the JSON-encoded data matches the schema, the returned list is empty if it does.
+// References to named types are resolved against defs.
+func (s *Schema) Validate(data []byte, defs map[string]*Schema) []SchemaError {
+	var v interface{}
+	if len(data) == 0 {
+		data = null
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return []SchemaError{{Path: "", Message: "invalid json: " + err.Error()}}
+	}
+	return s.validate(v, "", defs, nil)
+}
+
+func (s *Schema) validate(v interface{}, path string, defs map[string]*Schema, errs []SchemaError) []SchemaError {
+	fail := func(format string, args ...interface{}) []SchemaError {
+		return append(errs, SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Ref != "" {
+		ref, ok := defs[strings.TrimPrefix(s.Ref, schemaRefPrefix)]
+		if !ok {
+			return fail("unresolved reference %v", s.Ref)
+		}
+		if v == nil && s.Nullable {
+			return errs
+		}
+		return ref.validate(v, path, defs, errs)
+	}
+
+	if v == nil {
+		if s.Type == "" || s.Nullable {
+			return errs
+		}
+		return fail("expected %v, got null", s.Type)
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		return fail("value is not one of the allowed values")
+	}
+
+	switch v := v.(type) {
+	case bool:
+		if s.Type != "" && s.Type != "boolean" {
+			return fail("expected %v, got boolean", s.Type)
+		}
+	case float64:
+		switch {
+		case s.Type == "integer" && v != math.Trunc(v):
+			return fail("expected integer, got number")
+		case s.Type != "" && s.Type != "integer" && s.Type != "number":
+			return fail("expected %v, got number", s.Type)
+		case s.Minimum != nil && v < *s.Minimum:
+			return fail("must be greater than or equal to %v", *s.Minimum)
+		case s.Maximum != nil && v > *s.Maximum:
+			return fail("must be less than or equal to %v", *s.Maximum)
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		switch {
+		case s.Type != "" && s.Type != "string":
+			return fail("expected %v, got string", s.Type)
+		case s.MinLength != nil && n < *s.MinLength:
+			return fail("length must be greater than or equal to %v", *s.MinLength)
+		case s.MaxLength != nil && n > *s.MaxLength:
+			return fail("length must be less than or equal to %v", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if re, err := compilePattern(s.Pattern); err != nil {
+				errs = fail("invalid pattern %q", s.Pattern)
+			} else if !re.MatchString(v) {
+				errs = fail("does not match pattern %q", s.Pattern)
+			}
+		}
+		if s.Format == "date-time" && !isDateTime(v) {
+			errs = fail("invalid date-time")
+		}
+		if s.Format == "byte" && !isBase64(v) {
+			errs = fail("invalid base64 string")
+		}
+	case []interface{}:
+		switch {
+		case s.Type != "" && s.Type != "array":
+			return fail("expected %v, got array", s.Type)
+		case s.MinItems != nil && len(v) < *s.MinItems:
+			return fail("must have at least %v items", *s.MinItems)
+		case s.MaxItems != nil && len(v) > *s.MaxItems:
+			return fail("must have at most %v items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				errs = s.Items.validate(item, path+"/"+strconv.Itoa(i), defs, errs)
+			}
+		}
+	case map[string]interface{}:
+		if s.Type != "" && s.Type != "object" {
+			return fail("expected %v, got object", s.Type)
+		}
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, SchemaError{Path: path + "/" + escapePointer(name), Message: "missing required property"})
+			}
+		}
+		for _, name := range sortedKeys(v) {
+			prop, ok := s.Properties[name]
+			if !ok {
+				prop = s.AdditionalProperties
+			}
+			if prop != nil {
+				errs = prop.validate(v[name], path+"/"+escapePointer(name), defs, errs)
+			}
+		}
+	}
+	return errs
+}
+
+func inEnum(v interface{}, enum []interface{}) bool {
+	b, _ := json.Marshal(v)
+	for _, e := range enum {
+		if eb, _ := json.Marshal(e); string(eb) == string(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDateTime(s string) bool {
+	_, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil
+}
+
+func isBase64(s string) bool {
+	_, err := base64.StdEncoding.DecodeString(s)
+	return err == nil
+}
+
+// escapePointer escapes a property name to be used as a JSON pointer token.
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+// WithParamsSchema validates the params of every request against schema before
+// calling the handler. Requests that don't match are rejected with ErrInvalidParams,
+// with the list of SchemaError in its Data. An invalid Pattern of the schema fails the
+// registration of the method.
+func WithParamsSchema(schema *Schema) MethodOption {
+	return func(h *handlerType) {
+		h.paramsSchema = schema
+	}
+}
+
+// WithParamsValidation is like WithParamsSchema, using the schema derived from the
+// params type of the handler. Fields without omitempty are required.
+func WithParamsValidation() MethodOption {
+	return func(h *handlerType) {
+		if h.ptype != nil {
+			h.paramsSchema = schemaOf(h.ptype, h.schemaDefs())
+		}
+	}
+}
+
+// WithResultSchema sets the schema the results of the method are checked against
+// when the server is created WithResultValidation. By default it is derived from the
+// result type of the handler.
+func WithResultSchema(schema *Schema) MethodOption {
+	return func(h *handlerType) {
+		h.resultSchema = schema
+	}
+}
+
+// WithResultValidation enables the validation of outgoing results, meant for debugging.
+// Results that don't match their schema are logged and replaced by ErrInternalError.
+func WithResultValidation() ServerOption {
+	return func(s *Server) {
+		s.validateResults = true
+	}
+}
+
+// compileSchemas compiles the patterns of the schemas of the method.
+func (h *handlerType) compileSchemas() error {
+	if err := h.paramsSchema.compile(); err != nil {
+		return err
+	}
+	if err := h.resultSchema.compile(); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(h.defs) {
+		if err := h.defs[name].compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *handlerType) schemaDefs() map[string]*Schema {
+	if h.defs == nil {
+		h.defs = map[string]*Schema{}
+	}
+	return h.defs
+}
+
+// validateParams checks the params of req against the schema of the method, if any.
+func (s *Server) validateParams(req *request, htype *handlerType) []SchemaError {
+	if htype.paramsSchema == nil {
+		return nil
+	}
+	var v interface{}
+	if req.Params != nil {
+		if err := s.codec.Unmarshal(req.Params, &v); err != nil {
+			return []SchemaError{{Path: "", Message: "invalid json: " + err.Error()}}
+		}
+	}
+	return htype.paramsSchema.validate(v, "", htype.defs, nil)
+}
+
+// validateResult checks result against the schema of the method when result validation is enabled.
+func (s *Server) validateResult(result interface{}, htype *handlerType) []SchemaError {
+	if !s.validateResults || htype.resultSchema == nil {
+		return nil
+	}
+	b, err := s.codec.Marshal(result)
+	if err != nil {
+		// The encoding error is reported when the response is sent.
+		return nil
+	}
+	var v interface{}
+	if err := s.codec.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+	return htype.resultSchema.validate(v, "", htype.defs, nil)
+}
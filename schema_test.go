@@ -0,0 +1,226 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+var validateTestcases = []struct {
+	name   string
+	schema *Schema
+	data   string
+	errs   string
+}{
+	{
+		name:   "valid_object",
+		schema: &Schema{Ref: "#/components/schemas/github.com_echovl_jsonrpc.Node"},
+		data:   `{"value":1,"children":[{"value":2},{"value":3,"children":null}]}`,
+		errs:   `null`,
+	},
+	{
+		name:   "nested_errors",
+		schema: &Schema{Ref: "#/components/schemas/github.com_echovl_jsonrpc.Node"},
+		data:   `{"value":1.5,"children":[{"value":2},{"children":[]},"node"]}`,
+		errs:   `[{"path":"/children/1/value","message":"missing required property"},{"path":"/children/2","message":"expected object, got string"},{"path":"/value","message":"expected integer, got number"}]`,
+	},
+	{
+		name:   "null",
+		schema: &Schema{Type: "string"},
+		data:   `null`,
+		errs:   `[{"path":"","message":"expected string, got null"}]`,
+	},
+	{
+		name:   "string_constraints",
+		schema: &Schema{Type: "object", Properties: map[string]*Schema{"a/b": {Type: "string", MaxLength: intPtr(3)}, "c": {Type: "string", Pattern: "^[a-z]+$"}}},
+		data:   `{"a/b":"abcd","c":"ABC"}`,
+		errs:   `[{"path":"/a~1b","message":"length must be less than or equal to 3"},{"path":"/c","message":"does not match pattern \"^[a-z]+$\""}]`,
+	},
+	{
+		name:   "number_constraints",
+		schema: &Schema{Type: "array", MaxItems: intPtr(2), Items: &Schema{Type: "number", Minimum: floatPtr(0)}},
+		data:   `[1,-1]`,
+		errs:   `[{"path":"/1","message":"must be greater than or equal to 0"}]`,
+	},
+	{
+		name:   "enum",
+		schema: &Schema{Enum: []interface{}{"asc", "desc", 1}},
+		data:   `"up"`,
+		errs:   `[{"path":"","message":"value is not one of the allowed values"}]`,
+	},
+	{
+		name:   "date_time",
+		schema: &Schema{Type: "string", Format: "date-time"},
+		data:   `"yesterday"`,
+		errs:   `[{"path":"","message":"invalid date-time"}]`,
+	},
+	{
+		name:   "pattern_and_format",
+		schema: &Schema{Type: "string", Pattern: "^[0-9]", Format: "date-time"},
+		data:   `"2024-13-45"`,
+		errs:   `[{"path":"","message":"invalid date-time"}]`,
+	},
+	{
+		name:   "pattern_and_format_both_invalid",
+		schema: &Schema{Type: "string", Pattern: "^[a-z]+$", Format: "byte"},
+		data:   `"?"`,
+		errs:   `[{"path":"","message":"does not match pattern \"^[a-z]+$\""},{"path":"","message":"invalid base64 string"}]`,
+	},
+	{
+		name:   "nullable_ref",
+		schema: &Schema{Ref: "#/components/schemas/github.com_echovl_jsonrpc.Node", Nullable: true},
+		data:   `null`,
+		errs:   `null`,
+	},
+	{
+		name:   "invalid_pattern",
+		schema: &Schema{Type: "string", Pattern: "["},
+		data:   `"a"`,
+		errs:   `[{"path":"","message":"invalid pattern \"[\""}]`,
+	},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	defs := map[string]*Schema{}
+	schemaOf(reflect.TypeOf(Node{}), defs)
+
+	for _, tc := range validateTestcases {
+		t.Run(tc.name, func(t *testing.T) {
+			errs, _ := json.Marshal(tc.schema.Validate([]byte(tc.data), defs))
+			if string(errs) != tc.errs {
+				t.Errorf("invalid validation errors: \ngot: %s\nwant: %v\n", errs, tc.errs)
+			}
+		})
+	}
+}
+
+func TestSchemaOfStructTags(t *testing.T) {
+	type params struct {
+		ID    int64  `json:"id,string"`
+		Limit *uint  `json:"limit,string,omitempty"`
+		Count uint16 `json:"count"`
+	}
+	defs := map[string]*Schema{}
+	schema := structSchema(reflect.TypeOf(params{}), defs)
+	b, _ := json.Marshal(schema)
+	want := `{"type":"object","properties":{"count":{"type":"integer","minimum":0},"id":{"type":"string"},"limit":{"type":["string","null"]}},"required":["id","count"]}`
+	if string(b) != want {
+		t.Errorf("invalid schema: \ngot:  %s\nwant: %v", b, want)
+	}
+
+	limit := uint(10)
+	data, _ := json.Marshal(params{ID: 42, Limit: &limit, Count: 3})
+	if errs := schema.Validate(data, defs); errs != nil {
+		t.Errorf("encoded params %s: errors not expected: %v", data, errs)
+	}
+	errs, _ := json.Marshal(schema.Validate([]byte(`{"id":42,"count":-1}`), defs))
+	if want := `[{"path":"/count","message":"must be greater than or equal to 0"},{"path":"/id","message":"expected string, got number"}]`; string(errs) != want {
+		t.Errorf("invalid validation errors: \ngot: %s\nwant: %v\n", errs, want)
+	}
+}
+
+func TestSchemaJSON(t *testing.T) {
+	testcases := []struct {
+		schema *Schema
+		json   string
+	}{
+		{
+			schema: &Schema{Type: "string", Nullable: true, MaxLength: intPtr(3)},
+			json:   `{"type":["string","null"],"maxLength":3}`,
+		},
+		{
+			schema: &Schema{Ref: "#/components/schemas/Node", Nullable: true},
+			json:   `{"oneOf":[{"$ref":"#/components/schemas/Node"},{"type":"null"}]}`,
+		},
+		{
+			schema: &Schema{Type: "object", Properties: map[string]*Schema{"a": {Type: "integer", Nullable: true}}},
+			json:   `{"type":"object","properties":{"a":{"type":["integer","null"]}}}`,
+		},
+		{
+			schema: &Schema{Nullable: true},
+			json:   `{}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.json, func(t *testing.T) {
+			b, err := json.Marshal(tc.schema)
+			if err != nil || string(b) != tc.json {
+				t.Fatalf("invalid encoding: \ngot:  %s (%v)\nwant: %v", b, err, tc.json)
+			}
+			var decoded Schema
+			if err := json.Unmarshal(b, &decoded); err != nil {
+				t.Fatalf("decoding: error not expected: %v", err)
+			}
+			if b, _ := json.Marshal(&decoded); string(b) != tc.json {
+				t.Errorf("invalid decoding: \ngot:  %s\nwant: %v", b, tc.json)
+			}
+		})
+	}
+}
+
+func TestServeSchemaValidation(t *testing.T) {
+	server := NewServer(WithResultValidation())
+	server.HandleFunc("sum", sum, WithParamsValidation())
+	server.HandleFunc("positive", func(ctx context.Context, n int) (int, error) {
+		return -n, nil
+	}, WithParamsSchema(&Schema{Type: "integer", Minimum: floatPtr(1)}), WithResultSchema(&Schema{Type: "integer", Minimum: floatPtr(1)}))
+	invalid := &Schema{Type: "object", Properties: map[string]*Schema{"A": {Type: "string", Pattern: "["}}}
+	if err := server.HandleFunc("invalid", sum, WithParamsSchema(invalid)); err == nil || !strings.Contains(err.Error(), "invalid schema pattern") {
+		t.Errorf("expected an invalid pattern error, got %v", err)
+	}
+
+	testcases := []struct {
+		name string
+		req  string
+		resp string
+	}{
+		{
+			name: "valid",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}}`,
+			resp: `{"jsonrpc":"2.0","id":1,"result":{"C":3}}`,
+		},
+		{
+			name: "wrong_type",
+			req:  `{"jsonrpc":"2.0","id":2,"method":"sum","params":{"A":1,"B":"2"}}`,
+			resp: `{"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"Invalid params","data":[{"path":"/B","message":"expected integer, got string"}]}}`,
+		},
+		{
+			name: "missing_params",
+			req:  `{"jsonrpc":"2.0","id":3,"method":"sum"}`,
+			resp: `{"jsonrpc":"2.0","id":3,"error":{"code":-32602,"message":"Invalid params","data":[{"path":"","message":"expected object, got null"}]}}`,
+		},
+		{
+			name: "custom_schema",
+			req:  `{"jsonrpc":"2.0","id":4,"method":"positive","params":0}`,
+			resp: `{"jsonrpc":"2.0","id":4,"error":{"code":-32602,"message":"Invalid params","data":[{"path":"","message":"must be greater than or equal to 1"}]}}`,
+		},
+		{
+			name: "invalid_result",
+			req:  `{"jsonrpc":"2.0","id":5,"method":"positive","params":1}`,
+			resp: `{"jsonrpc":"2.0","id":5,"error":{"code":-32603,"message":"Internal error","data":[{"path":"","message":"must be greater than or equal to 1"}]}}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "locahost:8080", bytes.NewReader([]byte(tc.req)))
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+
+			if got := rw.Body.String(); got != tc.resp {
+				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, tc.resp)
+			}
+		})
+	}
+}
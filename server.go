@@ -1,51 +1,195 @@
 package jsonrpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"go/token"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"reflect"
 	"sync"
+	"time"
 )
 
 var (
 	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
 	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
 )
-var (
-	errServerInvalidParams = errors.New("invalid request params type format")
-	errServerInvalidReturn = errors.New("invalid return type format")
-)
+var errServerInvalidParams = errors.New("invalid request params type format")
 
-// Server represents a JSON-RPC server.
+// Server represents a JSON-RPC server. The zero value is a Server with the default
+// configuration of NewServer.
 type Server struct {
-	handler sync.Map
+	handler         sync.Map
+	codec           Codec
+	info            OpenRPCInfo
+	validateResults bool
+
+	registeredErrors   []registeredError
+	hideInternalErrors bool
+
+	compressors       []Compressor
+	compressResponses bool
+	compressMinSize   int
+	maxRequestSize    int64
+
+	interceptors []ServerInterceptor
+	metrics      MetricsRecorder
+
+	logger       *slog.Logger
+	accessLog    bool
+	redactParams bool
+
+	authenticator Authenticator
+
+	channels        sync.Map // subscription handlers by channelKey
+	maxConnRequests int
+
+	life lifecycle
+	once sync.Once // see init
+}
+
+type registeredError struct {
+	target error
+	code   int
+}
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithServerCodec sets the JSON engine used by the Server, the default is DefaultCodec.
+func WithServerCodec(codec Codec) ServerOption {
+	return func(s *Server) {
+		s.codec = codec
+	}
+}
+
+// WithRegisteredError sends handler errors matching target, as reported by errors.Is,
+// with the given code and the message of target.
+func WithRegisteredError(target error, code int) ServerOption {
+	return func(s *Server) {
+		s.registeredErrors = append(s.registeredErrors, registeredError{target: target, code: code})
+	}
 }
 
+// WithHiddenInternalErrors hides the message of handler errors that aren't JSON-RPC
+// errors, registered or ErrorCoder, they are logged and sent as ErrServerError instead.
+func WithHiddenInternalErrors() ServerOption {
+	return func(s *Server) {
+		s.hideInternalErrors = true
+	}
+}
+
+// handlerType caches the reflection metadata of a handler, computed once at registration.
 type handlerType struct {
-	f       reflect.Value
-	ptype   reflect.Type
-	rtype   reflect.Type
-	numArgs int
+	f        reflect.Value
+	ptype    reflect.Type
+	rtype    reflect.Type
+	pelem    reflect.Type // type allocated to decode the params
+	pIsValue bool         // params are passed by value instead of by pointer
+	numArgs  int
+	handler  Handler // set for handlers registered with Handle, which bypass reflection
+
+	// metadata for the OpenRPC document
+	description string
+	examples    []methodExample
+	errors      []*Error
+
+	// schemas validated at the server boundary, defs holds the named types they reference
+	paramsSchema *Schema
+	resultSchema *Schema
+	defs         map[string]*Schema
+
+	// authorization, see WithScopes and WithAnonymous
+	scopes    []string
+	anonymous bool
+
+	subscribe string // namespace of a "<namespace>_subscribe" method, see HandleSubscription
 }
 
-// NewServer returns a new Server.
-func NewServer() *Server {
-	return &Server{}
+// MethodOption configures a method at registration.
+type MethodOption func(*handlerType)
+
+// NewServer returns a new Server. The server describes itself through the
+// built-in rpc.discover method, see Server.OpenRPC.
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{}
+	s.init(opts...)
+	return s
+}
+
+// init sets the defaults of the server, applies opts and registers the built-in methods.
+// It runs once, from NewServer or on the first use of a zero Server.
+func (s *Server) init(opts ...ServerOption) {
+	s.once.Do(func() {
+		s.codec = DefaultCodec
+		s.info = OpenRPCInfo{Title: "JSON-RPC API", Version: "1.0.0"}
+		s.compressors = []Compressor{Gzip, Deflate}
+		s.maxRequestSize = DefaultMaxRequestSize
+		s.maxConnRequests = DefaultMaxConnRequests
+		s.life = newLifecycle()
+		for _, opt := range opts {
+			opt(s)
+		}
+		s.register(discoverMethod, &handlerType{handler: HandlerFunc(s.discover)}, nil)
+		s.register(cancelMethod, &handlerType{handler: HandlerFunc(s.cancelRequest)}, []MethodOption{WithAnonymous()})
+	})
 }
 
 // HandleFunc registers the handle function for the given JSON-RPC method.
-func (s *Server) HandleFunc(method string, handler interface{}) error {
+func (s *Server) HandleFunc(method string, handler interface{}, opts ...MethodOption) error {
+	s.init()
+	htype, err := newHandlerType(handler)
+	if err != nil {
+		return err
+	}
+	return s.register(method, htype, opts)
+}
+
+// newHandlerType inspects a handler function registered through reflection.
+func newHandlerType(handler interface{}) (*handlerType, error) {
 	h := reflect.ValueOf(handler)
 	numArgs, ptype, rtype, err := inspectHandler(h)
 	if err != nil {
-		return fmt.Errorf("jsonrpc: %v", err)
+		return nil, fmt.Errorf("jsonrpc: %v", err)
 	}
-	s.handler.Store(method, handlerType{f: h, ptype: ptype, rtype: rtype, numArgs: numArgs})
+	htype := &handlerType{f: h, ptype: ptype, rtype: rtype, numArgs: numArgs}
+	if numArgs == 2 {
+		htype.pelem = ptype
+		htype.pIsValue = true
+		if ptype.Kind() == reflect.Ptr {
+			htype.pelem = ptype.Elem()
+			htype.pIsValue = false
+		}
+	}
+	return htype, nil
+}
+
+// Handle registers the handler for the given JSON-RPC method. Unlike HandleFunc,
+// the handler is called directly, without reflection. It panics if the options are
+// invalid, such as a schema with an invalid pattern.
+func (s *Server) Handle(method string, handler Handler, opts ...MethodOption) {
+	s.init()
+	if err := s.register(method, &handlerType{handler: handler}, opts); err != nil {
+		panic(err)
+	}
+}
+
+func (s *Server) register(method string, htype *handlerType, opts []MethodOption) error {
+	for _, opt := range opts {
+		opt(htype)
+	}
+	if s.validateResults && htype.resultSchema == nil && htype.rtype != nil {
+		htype.resultSchema = schemaOf(htype.rtype, htype.schemaDefs())
+	}
+	if err := htype.compileSchemas(); err != nil {
+		return err
+	}
+	s.handler.Store(method, htype)
 	return nil
 }
 
@@ -94,130 +238,347 @@ func inspectHandler(h reflect.Value) (numArgs int, ptype, rtype reflect.Type, er
 }
 
 // ServeHTTP responds to an JSON-RPC request and executes the requested method.
+// A batch of requests is answered with an array holding the responses of its calls,
+// or with an empty body when it only holds notifications.
 func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	// Only POST methods are jsonrpc valid calls
+	s.init()
 	if r.Method != "POST" {
 		rw.WriteHeader(http.StatusNotFound)
 		rw.Write([]byte("Not found"))
 		return
 	}
 
-	ctx := r.Context()
-	req, err := decodeRequestFromReader(r.Body)
+	ctx, leave := s.life.enterHTTP(r.Context())
+	defer leave()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	out := getBuffer()
+	defer putBuffer(out)
 	defer r.Body.Close()
-	if errors.Is(err, errInvalidEncodedJSON) {
-		sendResponse(rw, errResponse(null, ErrorParseError))
+	body, err := decompressBody(s.compressors, r.Header.Get("Content-Encoding"), r.Body)
+	if errors.Is(err, errUnsupportedEncoding) {
+		s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: unsupported content encoding", remoteAttr(r.RemoteAddr), slog.String("encoding", r.Header.Get("Content-Encoding")))
+		rw.WriteHeader(http.StatusUnsupportedMediaType)
+		rw.Write([]byte("Unsupported content encoding"))
 		return
 	}
-	if errors.Is(err, errInvalidDecodedMessage) {
-		sendResponse(rw, errResponse(req.ID, ErrInvalidRequest))
+	if err == nil {
+		_, err = buf.ReadFrom(io.LimitReader(body, s.maxRequestSize+1))
+		body.Close()
+	}
+	if int64(buf.Len()) > s.maxRequestSize {
+		s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: request too large", remoteAttr(r.RemoteAddr), slog.Int64("limit", s.maxRequestSize))
+		rw.WriteHeader(http.StatusRequestEntityTooLarge)
+		rw.Write([]byte("Request too large"))
 		return
 	}
+	if err != nil {
+		s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: reading request", remoteAttr(r.RemoteAddr), slog.Any("error", err))
+		s.writeResponse(out, errResponse(null, ErrorParseError))
+	} else {
+		var stream *Stream
+		if !isBatch(buf.Bytes()) {
+			if stream = newStream(rw, r, s.codec); stream != nil {
+				ctx = context.WithValue(ctx, streamKey{}, stream)
+			}
+		}
+		s.serveMessage(s.authenticate(ctx, r, buf.Bytes()), &peer{header: r.Header, remoteAddr: r.RemoteAddr}, out, buf.Bytes())
+		if stream != nil {
+			streamed, err := stream.finish(out.Bytes())
+			if err != nil {
+				s.log().LogAttrs(ctx, slog.LevelError, "jsonrpc: writing response", remoteAttr(r.RemoteAddr), slog.Any("error", err))
+			}
+			if streamed {
+				return
+			}
+		}
+	}
 
-	method, ok := s.handler.Load(req.Method)
-	if !ok {
-		sendResponse(rw, errResponse(req.ID, ErrMethodNotFound))
+	if out.Len() == 0 {
+		rw.WriteHeader(http.StatusOK)
 		return
 	}
-
-	htype, _ := method.(handlerType)
-	if req.isNotification {
-		_, err := callMethod(ctx, req, htype)
-		if errors.Is(err, errServerInvalidParams) {
-			log.Print("jsonrpc: notification: ", err)
+	rw.Header().Set("Content-Type", "application/json")
+	if s.compressResponses {
+		rw.Header().Add("Vary", "Accept-Encoding")
+		if c := negotiateCompressor(s.compressors, r.Header); c != nil && out.Len() >= s.compressMinSize {
+			if err := s.writeCompressed(rw, c, out.Bytes()); err != nil {
+				s.log().LogAttrs(ctx, slog.LevelError, "jsonrpc: writing response", remoteAttr(r.RemoteAddr), slog.Any("error", err))
+			}
 			return
 		}
-		rw.WriteHeader(http.StatusOK)
-		rw.Write([]byte(""))
+	}
+	if _, err := rw.Write(out.Bytes()); err != nil {
+		s.log().LogAttrs(ctx, slog.LevelError, "jsonrpc: writing response", remoteAttr(r.RemoteAddr), slog.Any("error", err))
+	}
+}
+
+// writeCompressed writes the response body compressed with c, it writes the
+// body uncompressed if compression fails.
+func (s *Server) writeCompressed(rw http.ResponseWriter, c Compressor, data []byte) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := compress(c, buf, data); err != nil {
+		rw.Write(data)
+		return err
+	}
+	rw.Header().Set("Content-Encoding", c.Name())
+	_, err := rw.Write(buf.Bytes())
+	return err
+}
+
+// peer describes the client that sent a request, over HTTP or over a connection served with ServeConn.
+type peer struct {
+	header     http.Header
+	remoteAddr string
+}
+
+// serveMessage executes a request or a batch of requests and writes the response to out.
+func (s *Server) serveMessage(ctx context.Context, p *peer, out *bytes.Buffer, data []byte) {
+	if isBatch(data) {
+		s.serveBatch(ctx, p, out, bytes.TrimLeft(data, " \t\r\n"))
+	} else {
+		s.serveRequest(ctx, p, out, data)
+	}
+}
+
+func isBatch(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '['
+}
+
+// serveBatch executes the requests of a batch in order and writes the array of their responses to out.
+func (s *Server) serveBatch(ctx context.Context, p *peer, out *bytes.Buffer, data []byte) {
+	var batch []json.RawMessage
+	if err := s.codec.Unmarshal(data, &batch); err != nil {
+		s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: parse error", remoteAttr(p.remoteAddr))
+		s.writeResponse(out, errResponse(null, ErrorParseError))
 		return
 	}
+	if len(batch) == 0 {
+		s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: invalid request", remoteAttr(p.remoteAddr))
+		s.writeResponse(out, errResponse(null, ErrInvalidRequest))
+		return
+	}
+	out.WriteByte('[')
+	for _, data := range batch {
+		n := out.Len()
+		if n > 1 {
+			out.WriteByte(',')
+		}
+		m := out.Len()
+		if len(data) == 0 || data[0] != '{' {
+			// the batch is valid JSON, so anything but an object is an invalid request
+			s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: invalid request", remoteAttr(p.remoteAddr))
+			s.writeResponse(out, errResponse(null, ErrInvalidRequest))
+		} else if s.serveRequest(ctx, p, out, data); out.Len() == m {
+			// notifications have no response
+			out.Truncate(n)
+		}
+	}
+	if out.Len() == 1 {
+		out.Reset()
+		return
+	}
+	out.WriteByte(']')
+}
 
-	ret, err := callMethod(ctx, req, htype)
-	if errors.Is(err, errServerInvalidParams) {
-		sendResponse(rw, errResponse(req.ID, ErrInvalidParams))
+// serveRequest executes a single request and writes its response to out, nothing is
+// written for notifications.
+func (s *Server) serveRequest(ctx context.Context, p *peer, out *bytes.Buffer, data []byte) {
+	req, err := decodeRequest(s.codec, data)
+	if errors.Is(err, errInvalidEncodedJSON) {
+		s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: parse error", remoteAttr(p.remoteAddr))
+		s.writeResponse(out, errResponse(null, ErrorParseError))
+		return
+	}
+	if errors.Is(err, errInvalidDecodedMessage) {
+		s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: invalid request", remoteAttr(p.remoteAddr), slog.Any("id", req.ID))
+		s.writeResponse(out, errResponse(req.ID, ErrInvalidRequest))
 		return
 	}
 
-	result, err := encodeMethodReturn(ret)
-	if errors.Is(err, errServerInvalidReturn) {
-		sendResponse(rw, errResponse(req.ID, ErrInternalError))
+	start := time.Now()
+	var rpcErr *Error
+	if s.accessLog {
+		defer func() {
+			s.logAccess(ctx, p, req, rpcErr, time.Since(start))
+		}()
+	}
+
+	// Unknown methods are answered before the interceptors, which only see registered methods.
+	method, ok := s.handler.Load(req.Method)
+	if !ok {
+		rpcErr = ErrMethodNotFound
+		s.log().LogAttrs(ctx, slog.LevelDebug, "jsonrpc: method not found", remoteAttr(p.remoteAddr), slog.String("method", req.Method), slog.Any("id", req.ID))
+		s.writeResponse(out, errResponse(req.ID, rpcErr))
 		return
 	}
-	if err, ok := err.(*Error); ok {
-		sendResponse(rw, errResponse(req.ID, err))
+
+	if req.Method != cancelMethod && s.life.shuttingDown() {
+		rpcErr = ErrServerShuttingDown
+		if !req.isNotification {
+			s.writeResponse(out, errResponse(req.ID, rpcErr))
+		}
 		return
 	}
 
-	sendResponse(rw, &Response{
-		id:     req.ID,
-		error:  nil,
-		result: (json.RawMessage)(result),
+	htype, _ := method.(*handlerType)
+	info := &RequestInfo{
+		Method:       req.Method,
+		ID:           req.ID,
+		Params:       req.Params,
+		Notification: req.isNotification,
+		Header:       p.header,
+		RemoteAddr:   p.remoteAddr,
+	}
+	// finished stays false when the handler panics, the request is still recorded so the
+	// recorder can account for it.
+	var finished bool
+	if s.metrics != nil {
+		s.metrics.RequestStarted(req.Method)
+		n := out.Len()
+		defer func() {
+			m := RequestMetrics{Method: req.Method, Notification: req.isNotification, Duration: time.Since(start), RequestSize: len(data), ResponseSize: out.Len() - n}
+			if rpcErr != nil {
+				m.Code = rpcErr.Code
+			} else if !finished {
+				m.Code = ErrInternalError.Code
+			}
+			s.metrics.RequestFinished(m)
+		}()
+	}
+	ctx, done := s.track(ctx, req)
+	defer done()
+	ctx, closeProgress := s.withProgress(ctx, req)
+	result, err := s.intercept(ctx, info, func(ctx context.Context, info *RequestInfo) (interface{}, error) {
+		return s.invoke(ctx, info, htype)
 	})
+	closeProgress()
+	finished = true
+	if err != nil && context.Cause(ctx) == errRequestCancelled {
+		rpcErr = ErrRequestCancelled
+	} else if err != nil && context.Cause(ctx) == errServerShutdown {
+		rpcErr = ErrServerShuttingDown
+	} else if err != nil {
+		rpcErr = s.toError(ctx, info, err)
+	}
+	if req.isNotification {
+		if rpcErr != nil && rpcErr.Code == ErrInvalidParams.Code {
+			attrs := requestAttrs(info, slog.Any("error", rpcErr))
+			if rpcErr.Data != nil {
+				attrs = append(attrs, slog.Any("details", rpcErr.Data))
+			}
+			s.log().LogAttrs(ctx, slog.LevelWarn, "jsonrpc: notification with invalid params", attrs...)
+		}
+		return
+	}
+	if rpcErr != nil {
+		s.writeResponse(out, errResponse(req.ID, rpcErr))
+		return
+	}
+	s.writeResult(out, req.ID, result)
 }
 
-func sendResponse(rw http.ResponseWriter, resp *Response) {
-	b, err := resp.bytes()
-	if err != nil {
-		log.Printf("jsonrpc: sending response: %v", err)
-		return
+// invoke validates the params, calls the handler and validates its result. Errors are
+// returned as *Error so the interceptors can inspect their code.
+func (s *Server) invoke(ctx context.Context, info *RequestInfo, htype *handlerType) (interface{}, error) {
+	if htype.subscribe != "" {
+		return s.subscribe(ctx, info, htype.subscribe)
+	}
+	if err := s.authorize(ctx, info, htype); err != nil {
+		return nil, err
+	}
+	req := &request{ID: info.ID, Method: info.Method, Params: info.Params, isNotification: info.Notification}
+	if errs := s.validateParams(req, htype); len(errs) > 0 {
+		return nil, &Error{Code: ErrInvalidParams.Code, Message: ErrInvalidParams.Message, Data: errs}
+	}
+
+	result, err := s.callMethod(ctx, req, htype)
+	if errors.Is(err, errServerInvalidParams) {
+		return nil, ErrInvalidParams
 	}
-	_, err = rw.Write(b)
 	if err != nil {
-		log.Printf("jsonrpc: sending response: %v", err)
+		return nil, s.toError(ctx, info, err)
 	}
+	if errs := s.validateResult(result, htype); len(errs) > 0 {
+		s.log().LogAttrs(ctx, slog.LevelError, "jsonrpc: invalid result", requestAttrs(info, slog.Any("error", errs))...)
+		return nil, &Error{Code: ErrInternalError.Code, Message: ErrInternalError.Message, Data: errs}
+	}
+	return result, nil
 }
 
-func callMethod(ctx context.Context, req *request, htype handlerType) ([]reflect.Value, error) {
-	var retv []reflect.Value
-	if htype.numArgs == 1 {
-		retv = htype.f.Call([]reflect.Value{reflect.ValueOf(ctx)})
-		return retv, nil
+// toError converts err to a JSON-RPC error, logging the errors that aren't sent to the client.
+func (s *Server) toError(ctx context.Context, info *RequestInfo, err error) *Error {
+	rpcErr := s.asError(err)
+	if rpcErr == ErrServerError && err != ErrServerError {
+		s.log().LogAttrs(ctx, slog.LevelError, "jsonrpc: handler error", requestAttrs(info, slog.Any("error", err))...)
 	}
+	return rpcErr
+}
 
-	var pvalue, pzero reflect.Value
-	pIsValue := false
-	if htype.ptype.Kind() == reflect.Ptr {
-		pvalue = reflect.New(htype.ptype.Elem())
-		pzero = reflect.New(htype.ptype.Elem())
-	} else {
-		pvalue = reflect.New(htype.ptype)
-		pzero = reflect.New(htype.ptype)
-		pIsValue = true
+func (s *Server) writeResponse(out *bytes.Buffer, resp *Response) {
+	n := out.Len()
+	if err := resp.encode(s.codec, out); err != nil {
+		out.Truncate(n)
+		s.log().LogAttrs(context.Background(), slog.LevelError, "jsonrpc: encoding response", slog.Any("id", resp.id), slog.Any("error", err))
+	}
+}
+
+// writeResult encodes the result directly into the response, without an intermediate json.RawMessage.
+func (s *Server) writeResult(out *bytes.Buffer, id interface{}, result interface{}) {
+	if result == nil {
+		result = null
+	}
+	n := out.Len()
+	msg := responseMessage{Version: "2.0", ID: id, Result: result}
+	if err := s.codec.NewEncoder(out).Encode(msg); err != nil {
+		// this should not happen if the output is well defined
+		out.Truncate(n)
+		s.log().LogAttrs(context.Background(), slog.LevelError, "jsonrpc: encoding result", slog.Any("id", id), slog.Any("error", err))
+		s.writeResponse(out, errResponse(id, ErrInternalError))
+	}
+}
+
+// callMethod executes the handler and returns its result and error. Params that
+// can't be decoded into the handler's argument are reported as errServerInvalidParams.
+func (s *Server) callMethod(ctx context.Context, req *request, htype *handlerType) (interface{}, error) {
+	if htype.handler != nil {
+		result, err := htype.handler.ServeJSONRPC(ctx, Params{raw: req.Params, codec: s.codec})
+		if err == ErrInvalidParams {
+			return nil, errServerInvalidParams
+		}
+		return result, err
+	}
+
+	var ret []reflect.Value
+	if htype.numArgs == 1 {
+		ret = htype.f.Call([]reflect.Value{reflect.ValueOf(ctx)})
+		return ret[0].Interface(), methodError(ret)
 	}
 
-	// here pvalue is guaranteed to be a ptr
 	// QUESTION: if pvalue doesnt change params should be invalid?
 	if req.Params == nil || string(req.Params) == string(null) {
 		return nil, errServerInvalidParams
 	}
-	if err := json.Unmarshal(req.Params, pvalue.Interface()); err != nil || pvalue.Elem().Interface() == pzero.Elem().Interface() {
+	// here pvalue is guaranteed to be a ptr
+	pvalue := reflect.New(htype.pelem)
+	if err := s.codec.Unmarshal(req.Params, pvalue.Interface()); err != nil || pvalue.Elem().IsZero() {
 		return nil, errServerInvalidParams
 	}
 
-	if pIsValue {
-		retv = htype.f.Call([]reflect.Value{reflect.ValueOf(ctx), pvalue.Elem()})
-	} else {
-		retv = htype.f.Call([]reflect.Value{reflect.ValueOf(ctx), pvalue})
+	if htype.pIsValue {
+		pvalue = pvalue.Elem()
 	}
-	return retv, nil
+	ret = htype.f.Call([]reflect.Value{reflect.ValueOf(ctx), pvalue})
+	return ret[0].Interface(), methodError(ret)
 }
 
-func encodeMethodReturn(ret []reflect.Value) (json.RawMessage, error) {
-	outErr := ret[1].Interface()
-	switch err := outErr.(type) {
-	case *Error:
-		return nil, err
-	case error:
-		return nil, &Error{Code: -32000, Message: err.Error()}
-	default:
-	}
-
-	result, err := json.Marshal(ret[0].Interface())
-	if err != nil {
-		// this should not happen if the output is well defined
-		return nil, errServerInvalidReturn
-	}
-	return result, nil
+// methodError returns the error returned by a reflected handler, if any.
+func methodError(ret []reflect.Value) error {
+	err, _ := ret[1].Interface().(error)
+	return err
 }
 
 func isExportedOrBuiltinType(t reflect.Type) bool {
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -302,7 +303,7 @@ func TestHandleFunc(t *testing.T) {
 			if !ok {
 				t.Errorf("method %v not registered", tc.name)
 			}
-			htype, ok := v.(handlerType)
+			htype, ok := v.(*handlerType)
 			if !ok {
 				t.Errorf("handler with wrong type")
 			}
@@ -340,6 +341,9 @@ func TestServeErr(t *testing.T) {
 			if got := rw.Body.String(); got != want {
 				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, want)
 			}
+			if got := rw.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("invalid content type: \ngot: %v\nwant: application/json\n", got)
+			}
 		})
 	}
 }
@@ -380,6 +384,47 @@ func TestServeSync(t *testing.T) {
 	}
 }
 
+func TestZeroServer(t *testing.T) {
+	server := &Server{}
+	server.HandleFunc("sum", sum)
+
+	testcases := []struct {
+		name string
+		req  string
+		resp string
+	}{
+		{
+			name: "call",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"sum","params":{"a":1,"b":2}}`,
+			resp: `{"jsonrpc":"2.0","id":1,"result":{"C":3}}`,
+		},
+		{
+			name: "unknown_method",
+			req:  `{"jsonrpc":"2.0","id":2,"method":"unknown"}`,
+			resp: `{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"Method not found"}}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, httptest.NewRequest("POST", "localhost:8080", strings.NewReader(tc.req)))
+			if got := rw.Body.String(); got != tc.resp {
+				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, tc.resp)
+			}
+		})
+	}
+
+	if doc := server.OpenRPC(); len(doc.Methods) != 1 || doc.Methods[0].Name != "sum" {
+		t.Errorf("expected the sum method to be documented, got %+v", doc.Methods)
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: error not expected: %v", err)
+	}
+	if err := (&Server{}).Shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown of an unused server: error not expected: %v", err)
+	}
+}
+
 func TestServeAsync(t *testing.T) {
 	type request struct {
 		VersionTag string      `json:"jsonrpc"`
@@ -421,3 +466,147 @@ func TestServeAsync(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestHandle(t *testing.T) {
+	server := NewServer()
+	server.Handle("upper", HandlerFunc(func(ctx context.Context, params Params) (interface{}, error) {
+		var s Struct
+		if err := params.Decode(&s); err != nil {
+			return nil, err
+		}
+		return Struct{Text: s.Text + "!"}, nil
+	}))
+
+	testcases := []struct {
+		name string
+		req  string
+		resp string
+	}{
+		{
+			name: "valid",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"upper","params":{"text":"text"}}`,
+			resp: `{"jsonrpc":"2.0","id":1,"result":{"text":"text!"}}`,
+		},
+		{
+			name: "invalid_params",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"upper","params":{}}`,
+			resp: `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"Invalid params"}}`,
+		},
+		{
+			name: "missing_params",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"upper"}`,
+			resp: `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"Invalid params"}}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "locahost:8080", bytes.NewReader([]byte(tc.req)))
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+
+			if got := rw.Body.String(); got != tc.resp {
+				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, tc.resp)
+			}
+		})
+	}
+}
+
+func TestHandleGeneric(t *testing.T) {
+	server := NewServer()
+	Handle(server, "sum", sum)
+	Handle(server, "ptrstruct", func(ctx context.Context, s *Struct) (*Struct, error) {
+		return s, nil
+	})
+	HandleNoParams(server, "random", random)
+
+	testcases := []struct {
+		name string
+		req  string
+		resp string
+	}{
+		{
+			name: "sum",
+			req:  `{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}}`,
+			resp: `{"jsonrpc":"2.0","id":1,"result":{"C":3}}`,
+		},
+		{
+			name: "sum_invalid_params",
+			req:  `{"jsonrpc":"2.0","id":2,"method":"sum","params":[1,2]}`,
+			resp: `{"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"Invalid params"}}`,
+		},
+		{
+			name: "ptrstruct",
+			req:  `{"jsonrpc":"2.0","id":3,"method":"ptrstruct","params":{"text":"text"}}`,
+			resp: `{"jsonrpc":"2.0","id":3,"result":{"text":"text"}}`,
+		},
+		{
+			name: "ptrstruct_invalid_params",
+			req:  `{"jsonrpc":"2.0","id":4,"method":"ptrstruct","params":{}}`,
+			resp: `{"jsonrpc":"2.0","id":4,"error":{"code":-32602,"message":"Invalid params"}}`,
+		},
+		{
+			name: "random",
+			req:  `{"jsonrpc":"2.0","id":"5","method":"random"}`,
+			resp: `{"jsonrpc":"2.0","id":"5","result":{"C":33}}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "locahost:8080", bytes.NewReader([]byte(tc.req)))
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+
+			if got := rw.Body.String(); got != tc.resp {
+				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, tc.resp)
+			}
+		})
+	}
+}
+
+func TestServeBatch(t *testing.T) {
+	server := NewServer()
+	server.HandleFunc("sum", sum)
+
+	testcases := []struct {
+		name string
+		req  string
+		resp string
+	}{
+		{
+			name: "calls",
+			req:  `[{"jsonrpc":"2.0","id":1,"method":"sum","params":{"A":1,"B":2}},{"jsonrpc":"2.0","id":2,"method":"sum","params":{"A":3,"B":4}}]`,
+			resp: `[{"jsonrpc":"2.0","id":1,"result":{"C":3}},{"jsonrpc":"2.0","id":2,"result":{"C":7}}]`,
+		},
+		{
+			name: "mixed",
+			req:  `[{"jsonrpc":"2.0","method":"sum","params":{"A":1,"B":2}},{"jsonrpc":"2.0","id":2,"method":"foo"},{"jsonrpc":"2.0","method":"sum","params":{"A":1,"B":2}},1]`,
+			resp: `[{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"Method not found"}},{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request"}}]`,
+		},
+		{
+			name: "notifications",
+			req:  ` [{"jsonrpc":"2.0","method":"sum","params":{"A":1,"B":2}},{"jsonrpc":"2.0","method":"sum","params":{"A":3,"B":4}}]`,
+			resp: ``,
+		},
+		{
+			name: "empty",
+			req:  `[]`,
+			resp: `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request"}}`,
+		},
+		{
+			name: "invalid",
+			req:  `[{"jsonrpc":"2.0","id":1,"method":"sum"`,
+			resp: `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error"}}`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "locahost:8080", bytes.NewReader([]byte(tc.req)))
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+
+			if got := rw.Body.String(); got != tc.resp {
+				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, tc.resp)
+			}
+		})
+	}
+}
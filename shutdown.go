@@ -0,0 +1,192 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+var (
+	// ErrServerShuttingDown answers the calls received once Server.Shutdown is called.
+	ErrServerShuttingDown = &Error{Code: -32006, Message: "Server shutting down"}
+	// ErrServerClosed is returned by Server.Serve and Server.ServeConn once Server.Shutdown is called.
+	ErrServerClosed = errors.New("jsonrpc: server closed")
+
+	// errServerShutdown is the cause of the handler contexts canceled by Shutdown.
+	errServerShutdown = errors.New("jsonrpc: server shut down")
+)
+
+// lifecycle tracks the work of a Server, see Server.Shutdown.
+type lifecycle struct {
+	mu        sync.Mutex
+	closing   bool
+	active    int                         // messages being served
+	idle      chan struct{}               // closed once closing with no active messages
+	conns     map[*serverConn]func(error) // connections being served, with their abort function
+	connsDone chan struct{}               // closed once closing with no connections
+	listeners map[net.Listener]struct{}
+
+	halt     context.Context // canceled at the deadline of Shutdown
+	haltFunc context.CancelFunc
+}
+
+func newLifecycle() lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return lifecycle{
+		idle:      make(chan struct{}),
+		conns:     map[*serverConn]func(error){},
+		connsDone: make(chan struct{}),
+		listeners: map[net.Listener]struct{}{},
+		halt:      ctx,
+		haltFunc:  cancel,
+	}
+}
+
+// Shutdown gracefully shuts down the server. The calls received from then on fail with
+// ErrServerShuttingDown, except $/cancelRequest, and the listeners served with Serve are
+// closed. Shutdown waits for the messages being served to be answered, including the
+// notifications their handlers send before the response, then closes the connections
+// served with ServeConn, which ends their subscriptions, and waits for them to be closed.
+//
+// If ctx expires first, the contexts of the remaining handlers are canceled, the
+// connections are closed and Shutdown returns the error of ctx. Over HTTP, the canceled
+// calls are answered with ErrServerShuttingDown. Shutdown doesn't stop the http.Server
+// serving s, call http.Server.Shutdown as well.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.init()
+	l := &s.life
+	l.close()
+	if err := wait(ctx, l.idle); err != nil {
+		l.haltFunc()
+		l.closeConns()
+		return err
+	}
+	l.closeConns()
+	if err := wait(ctx, l.connsDone); err != nil {
+		l.haltFunc()
+		return err
+	}
+	return nil
+}
+
+// wait waits for done to be closed or ctx to expire.
+func wait(ctx context.Context, done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close stops accepting new work and closes the listeners. The counts only decrease from
+// then on, idle and connsDone are closed when they reach zero.
+func (l *lifecycle) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return
+	}
+	l.closing = true
+	for ln := range l.listeners {
+		ln.Close()
+	}
+	if l.active == 0 {
+		close(l.idle)
+	}
+	if len(l.conns) == 0 {
+		close(l.connsDone)
+	}
+}
+
+func (l *lifecycle) shuttingDown() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closing
+}
+
+// enter registers a message being served, leave must be called once it is answered.
+// Messages received during Shutdown aren't registered, their calls are rejected.
+func (l *lifecycle) enter() (leave func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return func() {}
+	}
+	l.active++
+	return l.leave
+}
+
+func (l *lifecycle) leave() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if l.closing && l.active == 0 {
+		close(l.idle)
+	}
+}
+
+// enterHTTP registers a message received over HTTP, the returned context is canceled at
+// the deadline of Shutdown.
+func (l *lifecycle) enterHTTP(ctx context.Context) (context.Context, func()) {
+	leave := l.enter()
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(l.halt, func() {
+		cancel(errServerShutdown)
+	})
+	return ctx, func() {
+		stop()
+		cancel(nil)
+		leave()
+	}
+}
+
+// addConn registers a connection, closed by Shutdown with abort(errServerShutdown). It
+// reports false once the server is shutting down.
+func (l *lifecycle) addConn(c *serverConn, abort func(cause error)) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return false
+	}
+	l.conns[c] = abort
+	return true
+}
+
+func (l *lifecycle) removeConn(c *serverConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.conns, c)
+	if l.closing && len(l.conns) == 0 {
+		close(l.connsDone)
+	}
+}
+
+func (l *lifecycle) closeConns() {
+	l.mu.Lock()
+	aborts := make([]func(error), 0, len(l.conns))
+	for _, abort := range l.conns {
+		aborts = append(aborts, abort)
+	}
+	l.mu.Unlock()
+	for _, abort := range aborts {
+		abort(errServerShutdown)
+	}
+}
+
+func (l *lifecycle) addListener(ln net.Listener) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return false
+	}
+	l.listeners[ln] = struct{}{}
+	return true
+}
+
+func (l *lifecycle) removeListener(ln net.Listener) {
+	l.mu.Lock()
+	delete(l.listeners, ln)
+	l.mu.Unlock()
+}
@@ -0,0 +1,223 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newShutdownServer returns a server whose "wait" method blocks until release is closed or its context is canceled.
+func newShutdownServer(started chan<- struct{}, release <-chan struct{}) *Server {
+	server := NewServer()
+	server.HandleFunc("wait", func(ctx context.Context) (string, error) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return "released", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+	return server
+}
+
+// shutdown calls server.Shutdown in a goroutine and waits until the new calls are rejected.
+func shutdown(ctx context.Context, server *Server) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Shutdown(ctx)
+	}()
+	for !server.life.shuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	return errc
+}
+
+func TestShutdownHTTP(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	server := newShutdownServer(started, release)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+
+	results := make(chan error, 1)
+	go func() {
+		resp, err := client.Call(context.Background(), "wait", nil)
+		if err == nil {
+			err = resp.Err()
+		}
+		results <- err
+	}()
+	<-started
+	errc := shutdown(context.Background(), server)
+
+	resp, err := client.Call(context.Background(), "wait", nil)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if err := resp.Err(); !errors.Is(err, ErrServerShuttingDown) {
+		t.Errorf("expected %v, got %v", ErrServerShuttingDown, err)
+	}
+	select {
+	case err := <-errc:
+		t.Fatalf("shutdown returned before the calls were answered: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if err := <-results; err != nil {
+		t.Errorf("in-flight call: error not expected: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("shutdown: error not expected: %v", err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started := make(chan struct{}, 1)
+	server := newShutdownServer(started, nil)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewClient(ts.URL)
+
+	results := make(chan error, 1)
+	go func() {
+		resp, err := client.Call(context.Background(), "wait", nil)
+		if err == nil {
+			err = resp.Err()
+		}
+		results <- err
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := <-results; !errors.Is(err, ErrServerShuttingDown) {
+		t.Errorf("expected %v, got %v", ErrServerShuttingDown, err)
+	}
+}
+
+func TestShutdownDeadlineConn(t *testing.T) {
+	started, causes, release := make(chan struct{}, 1), make(chan error, 1), make(chan struct{})
+	server := NewServer()
+	server.HandleFunc("wait", func(ctx context.Context) (string, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+		// the handler ignores the cancellation until it is released
+		<-release
+		return "", ctx.Err()
+	})
+	conn := serveConn(t, context.Background(), server)
+	defer close(release)
+	if _, err := conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"wait"}` + "\n")); err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if cause := <-causes; cause != errServerShutdown {
+		t.Errorf("expected cause %v, got %v", errServerShutdown, cause)
+	}
+	// Shutdown doesn't leave a goroutine waiting for the handler
+	buf := make([]byte, 8<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, "jsonrpc/shutdown.go") {
+			t.Errorf("goroutine left by Shutdown:\n%v", g)
+		}
+	}
+}
+
+func TestShutdownConn(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	server := newShutdownServer(started, release)
+	c1, c2 := net.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ServeConn(context.Background(), c1)
+	}()
+	client := NewConnClient(c2)
+	defer client.Close()
+
+	results := make(chan error, 1)
+	go func() {
+		resp, err := client.Call(context.Background(), "wait", nil)
+		if err == nil {
+			err = resp.Err()
+		}
+		results <- err
+	}()
+	<-started
+	errc := shutdown(context.Background(), server)
+
+	resp, err := client.Call(context.Background(), "wait", nil)
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if err := resp.Err(); !errors.Is(err, ErrServerShuttingDown) {
+		t.Errorf("expected %v, got %v", ErrServerShuttingDown, err)
+	}
+	close(release)
+	if err := <-results; err != nil {
+		t.Errorf("in-flight call: error not expected: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("shutdown: error not expected: %v", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("serve conn: expected %v, got %v", ErrServerClosed, err)
+	}
+	// the client reads the end of the connection
+	<-client.conn.done
+	if _, err := client.Call(context.Background(), "wait", nil); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("expected %v, got %v", ErrConnClosed, err)
+	}
+
+	// the connections served after Shutdown are closed
+	c1, c2 = net.Pipe()
+	defer c2.Close()
+	if err := server.ServeConn(context.Background(), c1); err != ErrServerClosed {
+		t.Errorf("serve conn: expected %v, got %v", ErrServerClosed, err)
+	}
+}
+
+func TestShutdownServe(t *testing.T) {
+	server := NewServer()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(l)
+	}()
+	client, err := Dial(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Call(context.Background(), "rpc.discover", nil); err != nil {
+		t.Fatalf("discover: error not expected: %v", err)
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: error not expected: %v", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("serve: expected %v, got %v", ErrServerClosed, err)
+	}
+	if _, err := client.Call(context.Background(), "rpc.discover", nil); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("expected a closed connection, got %v", err)
+	}
+}
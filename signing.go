@@ -0,0 +1,185 @@
+package jsonrpc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of the requests signed with WithHMACSigning.
+const (
+	SignatureHeader          = "Signature"
+	SignatureTimestampHeader = "Signature-Timestamp"
+	SignatureNonceHeader     = "Signature-Nonce"
+)
+
+// DefaultMaxClockSkew is the default maximum age of a signed request.
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// DefaultNonceCacheSize is the size of the NonceCache shared by the HMACAuthenticators
+// without one.
+const DefaultNonceCacheSize = 100000
+
+// ErrReplayedRequest is returned by HMACAuthenticator for a signed request already received.
+var ErrReplayedRequest = errors.New("jsonrpc: replayed request")
+
+// HMACAuthenticator authenticates requests signed with a shared key by a Client configured
+// with WithHMACSigning. The key id and the HMAC-SHA256 of the timestamp, the nonce and the
+// body are sent in the header "Signature: keyId=<id>, signature=<hex HMAC>", the timestamp
+// and the nonce in the Signature-Timestamp and Signature-Nonce headers. Requests older than
+// MaxClockSkew or whose nonce was already seen are rejected. The principal subject is the
+// key id.
+type HMACAuthenticator struct {
+	// Keys maps the key ids to their secrets, several keys can be active at once to rotate them.
+	Keys map[string][]byte
+	// Scopes maps the key ids to the scopes granted to their holders.
+	Scopes map[string][]string
+	// MaxClockSkew is the maximum difference between the timestamp of a request and the
+	// clock of the server, the default is DefaultMaxClockSkew.
+	MaxClockSkew time.Duration
+	// Nonces remembers the nonces of the requests received, a cache of DefaultNonceCacheSize
+	// nonces shared by the authenticators without one is used when nil.
+	Nonces *NonceCache
+}
+
+// Authenticate implements Authenticator.
+func (a HMACAuthenticator) Authenticate(r *http.Request, body []byte) (*Principal, error) {
+	header := r.Header.Get(SignatureHeader)
+	if header == "" {
+		return nil, ErrNoCredentials
+	}
+	params := parseSignature(header)
+	keyID := params["keyId"]
+	key, ok := a.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("jsonrpc: unknown key %q", keyID)
+	}
+
+	timestamp, nonce := r.Header.Get(SignatureTimestampHeader), r.Header.Get(SignatureNonceHeader)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return nil, errors.New("jsonrpc: missing signature timestamp or nonce")
+	}
+	maxSkew := a.MaxClockSkew
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxClockSkew
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > maxSkew || skew < -maxSkew {
+		return nil, errors.New("jsonrpc: stale signature timestamp")
+	}
+
+	sig, err := hex.DecodeString(params["signature"])
+	if err != nil {
+		return nil, errors.New("jsonrpc: malformed signature")
+	}
+	if !hmac.Equal(sig, signBody(key, timestamp, nonce, body)) {
+		return nil, errors.New("jsonrpc: invalid signature")
+	}
+
+	// Nonces are only remembered once the signature is verified, so forged requests can't fill the cache.
+	nonces := a.Nonces
+	if nonces == nil {
+		nonces = defaultNonceCache()
+	}
+	if !nonces.add(keyID + ":" + nonce) {
+		return nil, ErrReplayedRequest
+	}
+	return &Principal{Subject: keyID, Scopes: a.Scopes[keyID]}, nil
+}
+
+// WithHMACSigning signs the body of every request with key, identified by keyID on the
+// server, see HMACAuthenticator. Each attempt of a request gets its own timestamp and nonce.
+func WithHMACSigning(keyID string, key []byte) ClientOption {
+	return func(c *Client) {
+		c.signer = &hmacSigner{keyID: keyID, key: key}
+	}
+}
+
+type hmacSigner struct {
+	keyID string
+	key   []byte
+}
+
+// sign sets the signature headers of a request with the given body.
+func (s *hmacSigner) sign(header http.Header, body []byte) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("jsonrpc: generating nonce: %w", err)
+	}
+	timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(b)
+	header.Set(SignatureTimestampHeader, timestamp)
+	header.Set(SignatureNonceHeader, nonce)
+	header.Set(SignatureHeader, fmt.Sprintf(`keyId="%v", signature="%x"`, s.keyID, signBody(s.key, timestamp, nonce, body)))
+	return nil
+}
+
+// signBody returns the HMAC-SHA256 of the timestamp, the nonce and the body, separated by newlines.
+func signBody(key []byte, timestamp, nonce string, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// parseSignature parses the comma separated key=value pairs of a Signature header.
+func parseSignature(header string) map[string]string {
+	params := map[string]string{}
+	for _, param := range strings.Split(header, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok {
+			params[k] = strings.Trim(v, `"`)
+		}
+	}
+	return params
+}
+
+// NonceCache remembers a bounded number of nonces to detect replayed requests, the oldest
+// are forgotten first. Its size should exceed the number of requests received within
+// twice the MaxClockSkew of the authenticators using it. It is safe for concurrent use.
+// The zero value is a NonceCache of DefaultNonceCacheSize.
+type NonceCache struct {
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []string // ring buffer of the nonces in insertion order
+	next  int
+}
+
+// NewNonceCache returns a NonceCache remembering up to size nonces.
+func NewNonceCache(size int) *NonceCache {
+	if size <= 0 {
+		size = DefaultNonceCacheSize
+	}
+	return &NonceCache{seen: make(map[string]struct{}, size), order: make([]string, size)}
+}
+
+// defaultNonceCache is the cache of the HMACAuthenticators without Nonces, created on first use.
+var defaultNonceCache = sync.OnceValue(func() *NonceCache {
+	return NewNonceCache(DefaultNonceCacheSize)
+})
+
+// add remembers nonce and reports whether it was new.
+func (c *NonceCache) add(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.order == nil {
+		c.seen = map[string]struct{}{}
+		c.order = make([]string, DefaultNonceCacheSize)
+	}
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	if old := c.order[c.next]; old != "" {
+		delete(c.seen, old)
+	}
+	c.order[c.next] = nonce
+	c.next = (c.next + 1) % len(c.order)
+	c.seen[nonce] = struct{}{}
+	return true
+}
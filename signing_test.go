@@ -0,0 +1,240 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMACSigning(t *testing.T) {
+	auth := HMACAuthenticator{
+		Keys:   map[string][]byte{"k1": []byte("old"), "k2": []byte("new")},
+		Scopes: map[string][]string{"k2": {"admin"}},
+	}
+	ts := httptest.NewServer(newAuthServer(auth))
+	defer ts.Close()
+
+	testcases := []struct {
+		name    string
+		keyID   string
+		key     string
+		method  string
+		opts    []ClientOption
+		subject string
+		err     *Error
+	}{
+		{name: "old_key", keyID: "k1", key: "old", method: "whoami", subject: "k1"},
+		{name: "new_key", keyID: "k2", key: "new", method: "admin", subject: "k2"},
+		{name: "compressed", keyID: "k2", key: "new", method: "whoami", opts: []ClientOption{WithClientCompression(Gzip, 0)}, subject: "k2"},
+		{name: "missing_scope", keyID: "k1", key: "old", method: "admin", err: ErrForbidden},
+		{name: "wrong_key", keyID: "k2", key: "old", method: "whoami", err: ErrUnauthorized},
+		{name: "unknown_key", keyID: "k3", key: "old", method: "whoami", err: ErrUnauthorized},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewClient(ts.URL, append([]ClientOption{WithHMACSigning(tc.keyID, []byte(tc.key))}, tc.opts...)...)
+			resp, err := client.Call(context.Background(), tc.method, nil)
+			if err != nil {
+				t.Fatalf("%v: error not expected: %v", tc.method, err)
+			}
+			if tc.err != nil {
+				if !errors.Is(resp.Err(), tc.err) {
+					t.Errorf("%v: expected %v, got %v", tc.method, tc.err, resp.Err())
+				}
+				return
+			}
+			var subject string
+			if err := resp.Decode(&subject); err != nil {
+				t.Fatalf("%v: error not expected: %v", tc.method, err)
+			}
+			if subject != tc.subject {
+				t.Errorf("%v: expected subject %v, got %v", tc.method, tc.subject, subject)
+			}
+		})
+	}
+}
+
+func signedRequest(keyID, key string, timestamp int64, nonce, body string) *http.Request {
+	req := httptest.NewRequest("POST", "localhost:8080", strings.NewReader(body))
+	ts := strconv.FormatInt(timestamp, 10)
+	req.Header.Set(SignatureTimestampHeader, ts)
+	req.Header.Set(SignatureNonceHeader, nonce)
+	req.Header.Set(SignatureHeader, fmt.Sprintf(`keyId="%v", signature="%x"`, keyID, signBody([]byte(key), ts, nonce, []byte(body))))
+	return req
+}
+
+func TestHMACAuth(t *testing.T) {
+	server := newAuthServer(HMACAuthenticator{
+		Keys:   map[string][]byte{"k1": []byte("old"), "k2": []byte("new")},
+		Scopes: map[string][]string{"k2": {"admin"}},
+		Nonces: NewNonceCache(10),
+	})
+	body := `[{"jsonrpc":"2.0","id":1,"method":"whoami"},{"jsonrpc":"2.0","id":2,"method":"admin"}]`
+	now := time.Now().Unix()
+
+	testcases := []struct {
+		name string
+		req  *http.Request
+		resp string
+	}{
+		{
+			name: "old_key",
+			req:  signedRequest("k1", "old", now, "n1", body),
+			resp: `[{"jsonrpc":"2.0","id":1,"result":"k1"},{"jsonrpc":"2.0","id":2,"error":{"code":-32003,"message":"Forbidden"}}]`,
+		},
+		{
+			name: "new_key",
+			req:  signedRequest("k2", "new", now, "n2", body),
+			resp: `[{"jsonrpc":"2.0","id":1,"result":"k2"},{"jsonrpc":"2.0","id":2,"result":"k2"}]`,
+		},
+		{
+			name: "wrong_key",
+			req:  signedRequest("k2", "old", now, "n3", body),
+			resp: `[{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"Unauthorized"}},{"jsonrpc":"2.0","id":2,"error":{"code":-32001,"message":"Unauthorized"}}]`,
+		},
+		{
+			name: "unknown_key",
+			req:  signedRequest("k3", "old", now, "n4", body),
+			resp: `[{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"Unauthorized"}},{"jsonrpc":"2.0","id":2,"error":{"code":-32001,"message":"Unauthorized"}}]`,
+		},
+		{
+			name: "replayed",
+			req:  signedRequest("k1", "old", now, "n1", body),
+			resp: `[{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"Unauthorized"}},{"jsonrpc":"2.0","id":2,"error":{"code":-32001,"message":"Unauthorized"}}]`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, tc.req)
+			if got := rw.Body.String(); got != tc.resp {
+				t.Errorf("invalid jsonrpc response: \ngot: %v\nwant: %v\n", got, tc.resp)
+			}
+		})
+	}
+}
+
+func TestHMACReplay(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"whoami"}`
+	now := time.Now().Unix()
+	hour := int64(time.Hour / time.Second)
+
+	testcases := []struct {
+		name string
+		req  *http.Request
+		err  string
+	}{
+		{name: "valid", req: signedRequest("k", "secret", now, "n1", body)},
+		{name: "replayed", req: signedRequest("k", "secret", now, "n1", body), err: "jsonrpc: replayed request"},
+		{name: "other_nonce", req: signedRequest("k", "secret", now, "n2", body)},
+		{name: "stale", req: signedRequest("k", "secret", now-hour, "n3", body), err: "jsonrpc: stale signature timestamp"},
+		{name: "future", req: signedRequest("k", "secret", now+hour, "n4", body), err: "jsonrpc: stale signature timestamp"},
+		{name: "evicted", req: signedRequest("k", "secret", now, "n1", body)},
+		{name: "skew_allowed", req: signedRequest("k", "secret", now-60, "n6", body)},
+		{name: "skew_exceeded", req: signedRequest("k", "secret", now-180, "n8", body), err: "jsonrpc: stale signature timestamp"},
+		{name: "tampered", req: signedRequest("k", "secret", now, "n7", `{"jsonrpc":"2.0","id":2,"method":"whoami"}`), err: "jsonrpc: invalid signature"},
+		{name: "no_nonce", req: signedRequest("k", "secret", now, "", body), err: "jsonrpc: missing signature timestamp or nonce"},
+		{name: "no_signature", req: httptest.NewRequest("POST", "localhost:8080", strings.NewReader(body)), err: "jsonrpc: no credentials"},
+	}
+
+	// the cache remembers 2 nonces, n1 is evicted by n2 and n5
+	auth := HMACAuthenticator{Keys: map[string][]byte{"k": []byte("secret")}, MaxClockSkew: 2 * time.Minute, Nonces: NewNonceCache(2)}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.name == "evicted" {
+				auth.Authenticate(signedRequest("k", "secret", now, "n5", body), []byte(body))
+			}
+			_, err := auth.Authenticate(tc.req, []byte(body))
+			if got := fmt.Sprint(err); (tc.err == "" && err != nil) || (tc.err != "" && got != tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestHMACNonceCache(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"whoami"}`
+	keys := map[string][]byte{"k": []byte("secret")}
+	now := time.Now().Unix()
+
+	testcases := []struct {
+		name   string
+		first  HMACAuthenticator
+		second HMACAuthenticator
+		err    error
+	}{
+		{
+			name:   "default_cache",
+			first:  HMACAuthenticator{Keys: keys},
+			second: HMACAuthenticator{Keys: keys},
+			err:    ErrReplayedRequest,
+		},
+		{
+			name:  "copies",
+			first: HMACAuthenticator{Keys: keys, Nonces: NewNonceCache(10)},
+			err:   ErrReplayedRequest,
+		},
+		{
+			name:  "zero_cache",
+			first: HMACAuthenticator{Keys: keys, Nonces: &NonceCache{}},
+			err:   ErrReplayedRequest,
+		},
+		{
+			name:   "separate_caches",
+			first:  HMACAuthenticator{Keys: keys, Nonces: NewNonceCache(10)},
+			second: HMACAuthenticator{Keys: keys, Nonces: NewNonceCache(10)},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			second := tc.second
+			if second.Keys == nil {
+				second = tc.first
+			}
+			nonce := "nonce-" + tc.name + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+			if _, err := tc.first.Authenticate(signedRequest("k", "secret", now, nonce, body), []byte(body)); err != nil {
+				t.Fatalf("first request: error not expected: %v", err)
+			}
+			if _, err := second.Authenticate(signedRequest("k", "secret", now, nonce, body), []byte(body)); err != tc.err {
+				t.Errorf("replayed request: expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestHMACSigningRetry(t *testing.T) {
+	auth := HMACAuthenticator{Keys: map[string][]byte{"k": []byte("secret")}}
+	server := newAuthServer(auth)
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			// authenticate the first attempt, then fail it so it is retried with the same body
+			buf := &bytes.Buffer{}
+			buf.ReadFrom(r.Body)
+			auth.Authenticate(r, buf.Bytes())
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(rw, r)
+	}))
+	defer ts.Close()
+
+	policy := DefaultRetryPolicy("whoami")
+	policy.InitialBackoff = time.Millisecond
+	client := NewClient(ts.URL, WithHMACSigning("k", []byte("secret")), WithRetryPolicy(policy))
+	resp, err := client.Call(context.Background(), "whoami", nil)
+	if err != nil {
+		t.Fatalf("whoami: error not expected: %v", err)
+	}
+	if resp.Err() != nil {
+		t.Errorf("whoami: retried request rejected: %v", resp.Err())
+	}
+}
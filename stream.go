@@ -0,0 +1,178 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrStreamClosed is returned by Stream.Notify and ReportProgress once the response of the request is sent.
+var ErrStreamClosed = errors.New("jsonrpc: stream closed")
+
+// eventStreamType is the media type of Server-Sent Events.
+const eventStreamType = "text/event-stream"
+
+type streamKey struct{}
+
+// Stream sends notifications to the client of a request before its response, as
+// Server-Sent Events. See StreamFromContext.
+type Stream struct {
+	rw      http.ResponseWriter
+	flusher http.Flusher
+	codec   Codec
+
+	mu      sync.Mutex
+	started bool // the headers of the event stream were written
+	closed  bool
+}
+
+// StreamFromContext returns the stream of the request handled with ctx. Streams are
+// opt-in: ok is false unless the client accepts text/event-stream responses, see
+// OnNotification, and the request is a single call over HTTP.
+func StreamFromContext(ctx context.Context) (*Stream, bool) {
+	stream, ok := ctx.Value(streamKey{}).(*Stream)
+	return stream, ok
+}
+
+// newStream returns the stream of an HTTP request if the client accepts event streams.
+func newStream(rw http.ResponseWriter, r *http.Request, codec Codec) *Stream {
+	flusher, ok := rw.(http.Flusher)
+	if !ok || !acceptsEventStream(r.Header) {
+		return nil
+	}
+	return &Stream{rw: rw, flusher: flusher, codec: codec}
+}
+
+func acceptsEventStream(header http.Header) bool {
+	for _, value := range header.Values("Accept") {
+		for _, accept := range strings.Split(value, ",") {
+			if mediaType, _, err := mime.ParseMediaType(accept); err == nil && mediaType == eventStreamType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Notify sends a notification to the client. The response switches to an event stream
+// on the first notification, the JSON-RPC response is then sent as its last event.
+func (s *Stream) Notify(method string, params interface{}) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := s.codec.NewEncoder(buf).Encode(notificationMessage{Version: "2.0", Method: method, Params: params}); err != nil {
+		return fmt.Errorf("jsonrpc: encoding notification: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if !s.started {
+		s.started = true
+		s.rw.Header().Set("Content-Type", eventStreamType)
+		s.rw.Header().Set("Cache-Control", "no-cache")
+		s.rw.WriteHeader(http.StatusOK)
+	}
+	return s.event(buf.Bytes())
+}
+
+// finish closes the stream and reports whether it was started, the response is then sent as its last event.
+func (s *Stream) finish(resp []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if !s.started || len(resp) == 0 {
+		return s.started, nil
+	}
+	return true, s.event(resp)
+}
+
+// event writes an event holding a JSON-RPC message, the encoders don't write newlines.
+func (s *Stream) event(data []byte) error {
+	if _, err := fmt.Fprintf(s.rw, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Notification is a notification received by a Client.
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
+// CallOption configures a single call of Client.Call or Client.Go.
+type CallOption func(*request)
+
+// OnNotification calls f with the notifications sent by the handler of the call before
+// its response, see StreamFromContext. f is called by the goroutine of the call,
+// in order. The notifications of a retried call are received again.
+func OnNotification(f func(Notification)) CallOption {
+	return func(r *request) {
+		r.onNotification = f
+	}
+}
+
+func isEventStream(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == eventStreamType
+}
+
+// readStream reads an event stream, passing the notifications to the callback of req
+// until the response is received.
+func (c *Client) readStream(body io.Reader, req *request, resp *Response) error {
+	r := bufio.NewReader(body)
+	var data []byte
+	for {
+		line, err := readMessage(r, c.maxResponseSize)
+		if err == errMessageTooLarge {
+			return ErrResponseTooLarge
+		}
+		if err == io.EOF {
+			return errors.New("jsonrpc: reading response: event stream ended without a response")
+		}
+		if err != nil {
+			return fmt.Errorf("jsonrpc: reading response: %w", err)
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > 0 {
+			// only the data of the events is used, the other fields and the comments are ignored
+			if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+				if len(data) > 0 {
+					data = append(data, '\n')
+				}
+				data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+			}
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+		msg := &rawMessage{}
+		if err := c.codec.Unmarshal(data, msg); err != nil {
+			return fmt.Errorf("jsonrpc: reading response: %w", errInvalidEncodedJSON)
+		}
+		if msg.Method == "" {
+			if err := decodeResponse(c.codec, data, resp); err != nil {
+				return fmt.Errorf("jsonrpc: reading response: %w", err)
+			}
+			resp.size = len(data)
+			return nil
+		}
+		if msg.Method == progressMethod && req.progress(c.codec, msg.Params) {
+			// reported to OnProgress
+		} else if req.onNotification != nil {
+			req.onNotification(Notification{Method: msg.Method, Params: msg.Params})
+		}
+		data = data[:0]
+	}
+}
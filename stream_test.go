@@ -0,0 +1,141 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type ImportArgs struct {
+	Items int
+	Quiet bool
+}
+
+// newStreamServer returns a server whose "import" method reports its progress on the stream of the request.
+func newStreamServer(streams chan<- *Stream) *Server {
+	server := NewServer()
+	server.HandleFunc("import", func(ctx context.Context, args ImportArgs) (string, error) {
+		stream, ok := StreamFromContext(ctx)
+		if !ok {
+			return "not streamed", nil
+		}
+		for i := 1; i <= args.Items && !args.Quiet; i++ {
+			if err := stream.Notify("import.progress", map[string]int{"done": i, "total": args.Items}); err != nil {
+				return "", err
+			}
+		}
+		if streams != nil {
+			streams <- stream
+		}
+		return "imported", nil
+	})
+	return server
+}
+
+func TestStream(t *testing.T) {
+	testcases := []struct {
+		name   string
+		accept string
+		req    string
+		ctype  string
+		body   string
+	}{
+		{
+			name:   "streamed",
+			accept: "application/json, text/event-stream",
+			req:    `{"jsonrpc":"2.0","id":1,"method":"import","params":{"Items":2}}`,
+			ctype:  "text/event-stream",
+			body: `data: {"jsonrpc":"2.0","method":"import.progress","params":{"done":1,"total":2}}` + "\n\n" +
+				`data: {"jsonrpc":"2.0","method":"import.progress","params":{"done":2,"total":2}}` + "\n\n" +
+				`data: {"jsonrpc":"2.0","id":1,"result":"imported"}` + "\n\n",
+		},
+		{
+			name:   "no_notifications",
+			accept: "text/event-stream",
+			req:    `{"jsonrpc":"2.0","id":1,"method":"import","params":{"Items":2,"Quiet":true}}`,
+			ctype:  "application/json",
+			body:   `{"jsonrpc":"2.0","id":1,"result":"imported"}`,
+		},
+		{
+			name:   "not_accepted",
+			accept: "application/json",
+			req:    `{"jsonrpc":"2.0","id":1,"method":"import","params":{"Items":2}}`,
+			ctype:  "application/json",
+			body:   `{"jsonrpc":"2.0","id":1,"result":"not streamed"}`,
+		},
+		{
+			name:   "batch",
+			accept: "text/event-stream",
+			req:    `[{"jsonrpc":"2.0","id":1,"method":"import","params":{"Items":2}}]`,
+			ctype:  "application/json",
+			body:   `[{"jsonrpc":"2.0","id":1,"result":"not streamed"}]`,
+		},
+	}
+
+	server := newStreamServer(nil)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "localhost:8080", strings.NewReader(tc.req))
+			req.Header.Set("Accept", tc.accept)
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, req)
+
+			if ctype := rw.Header().Get("Content-Type"); ctype != tc.ctype {
+				t.Errorf("expected content type %v, got %v", tc.ctype, ctype)
+			}
+			if body, _ := io.ReadAll(rw.Body); string(body) != tc.body {
+				t.Errorf("invalid body: \ngot:\n%v\nwant:\n%v", string(body), tc.body)
+			}
+		})
+	}
+}
+
+func TestStreamClient(t *testing.T) {
+	streams := make(chan *Stream, 1)
+	ts := httptest.NewServer(newStreamServer(streams))
+	defer ts.Close()
+	client := NewClient(ts.URL)
+
+	var progress []string
+	resp, err := client.Call(context.Background(), "import", ImportArgs{Items: 3}, OnNotification(func(n Notification) {
+		progress = append(progress, n.Method+" "+string(n.Params))
+	}))
+	if err != nil {
+		t.Fatalf("import: error not expected: %v", err)
+	}
+	var result string
+	if err := resp.Decode(&result); err != nil || result != "imported" {
+		t.Errorf("import: expected imported, got %v (%v)", result, err)
+	}
+	want := []string{
+		`import.progress {"done":1,"total":3}`,
+		`import.progress {"done":2,"total":3}`,
+		`import.progress {"done":3,"total":3}`,
+	}
+	if got, _ := json.Marshal(progress); string(got) != mustMarshal(want) {
+		t.Errorf("invalid notifications: \ngot:  %v\nwant: %v", progress, want)
+	}
+	if err := (<-streams).Notify("import.progress", nil); err != ErrStreamClosed {
+		t.Errorf("expected %v, got %v", ErrStreamClosed, err)
+	}
+
+	// without OnNotification the call isn't streamed
+	resp, err = client.Call(context.Background(), "import", ImportArgs{Items: 3})
+	if err != nil {
+		t.Fatalf("import: error not expected: %v", err)
+	}
+	if err := resp.Decode(&result); err != nil || result != "not streamed" {
+		t.Errorf("import: expected not streamed, got %v (%v)", result, err)
+	}
+}
+
+func mustMarshal(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
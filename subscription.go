@@ -0,0 +1,448 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSubscriptionsUnsupported is returned when subscribing without a connection, over HTTP.
+	ErrSubscriptionsUnsupported = &Error{Code: -32004, Message: "Subscriptions not supported"}
+	// ErrSubscriptionNotFound is returned when unsubscribing from an unknown subscription.
+	ErrSubscriptionNotFound = &Error{Code: -32005, Message: "Subscription not found"}
+
+	// ErrSubscriptionClosed is returned by Subscription.Notify once the subscription is closed.
+	ErrSubscriptionClosed = errors.New("jsonrpc: subscription closed")
+	// ErrSubscriptionQueueOverflow ends a ClientSubscription whose channel doesn't keep up with the notifications.
+	ErrSubscriptionQueueOverflow = errors.New("jsonrpc: subscription queue overflow")
+)
+
+const (
+	subscribeSuffix    = "_subscribe"
+	unsubscribeSuffix  = "_unsubscribe"
+	subscriptionSuffix = "_subscription"
+
+	// maxSubscriptionQueue is the number of notifications a ClientSubscription buffers
+	// while its channel is not read.
+	maxSubscriptionQueue = 20000
+	// unsubscribeTimeout bounds the call made by ClientSubscription.Unsubscribe.
+	unsubscribeTimeout = 10 * time.Second
+)
+
+var typeOfSubscription = reflect.TypeOf((*Subscription)(nil))
+
+type channelKey struct {
+	namespace string
+	channel   string
+}
+
+type subscribeKey struct{}
+
+// subscribeCall holds the subscriptions created by a subscription handler.
+type subscribeCall struct {
+	conn    *serverConn
+	method  string
+	created []*Subscription
+}
+
+// HandleSubscription registers handler as a channel of the namespace. Clients subscribe by
+// calling "<namespace>_subscribe" with the channel name followed by the params of the
+// handler, ["newHeads"] or ["logs", {...}], and get the id of the subscription. The values
+// passed to Subscription.Notify are then pushed as "<namespace>_subscription" notifications,
+// {"subscription": id, "result": value}, until the client calls "<namespace>_unsubscribe"
+// with the id or disconnects.
+//
+// The handler follows the rules of HandleFunc, but returns the *Subscription created with
+// NewSubscription. Subscriptions need a connection served with ServeConn, over HTTP the
+// calls fail with ErrSubscriptionsUnsupported.
+func (s *Server) HandleSubscription(namespace, channel string, handler interface{}, opts ...MethodOption) error {
+	s.init()
+	htype, err := newHandlerType(handler)
+	if err != nil {
+		return err
+	}
+	if htype.rtype != typeOfSubscription {
+		return fmt.Errorf("jsonrpc: invalid first return type: expected %v, got %v", typeOfSubscription, htype.rtype)
+	}
+	for _, opt := range opts {
+		opt(htype)
+	}
+	if err := htype.compileSchemas(); err != nil {
+		return err
+	}
+	s.channels.Store(channelKey{namespace: namespace, channel: channel}, htype)
+	if _, loaded := s.handler.Load(namespace + subscribeSuffix); !loaded {
+		// The subscriptions are authorized by the handler of their channel.
+		s.handler.Store(namespace+subscribeSuffix, &handlerType{
+			subscribe:   namespace,
+			anonymous:   true,
+			description: "Subscribes to a channel of the " + namespace + " namespace.",
+		})
+		s.Handle(namespace+unsubscribeSuffix, s.unsubscribe(namespace), WithAnonymous(),
+			WithDescription("Cancels a subscription of the "+namespace+" namespace."))
+	}
+	return nil
+}
+
+// subscribe executes a "<namespace>_subscribe" request with the handler of the channel
+// named by its first param.
+func (s *Server) subscribe(ctx context.Context, info *RequestInfo, namespace string) (interface{}, error) {
+	msg, ok := ctx.Value(connKey{}).(*connMessage)
+	if !ok {
+		return nil, ErrSubscriptionsUnsupported
+	}
+	var args []json.RawMessage
+	if err := s.codec.Unmarshal(info.Params, &args); err != nil || len(args) == 0 || len(args) > 2 {
+		return nil, ErrInvalidParams
+	}
+	var channel string
+	if err := s.codec.Unmarshal(args[0], &channel); err != nil {
+		return nil, ErrInvalidParams
+	}
+	htype, ok := s.channels.Load(channelKey{namespace: namespace, channel: channel})
+	if !ok {
+		return nil, ErrMethodNotFound
+	}
+
+	chinfo := *info
+	chinfo.Params = nil
+	if len(args) == 2 {
+		chinfo.Params = args[1]
+	}
+	call := &subscribeCall{conn: msg.conn, method: namespace + subscriptionSuffix}
+	result, err := s.invoke(context.WithValue(ctx, subscribeKey{}, call), &chinfo, htype.(*handlerType))
+	sub, _ := result.(*Subscription)
+	for _, created := range call.created {
+		if created != sub || err != nil {
+			created.close()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil || sub.conn != msg.conn {
+		s.log().LogAttrs(ctx, slog.LevelError, "jsonrpc: subscription not created with NewSubscription", requestAttrs(info)...)
+		return nil, ErrInternalError
+	}
+	msg.subscriptions = append(msg.subscriptions, sub)
+	return sub.ID, nil
+}
+
+// unsubscribe returns the handler of the "<namespace>_unsubscribe" method.
+func (s *Server) unsubscribe(namespace string) HandlerFunc {
+	return func(ctx context.Context, params Params) (interface{}, error) {
+		msg, ok := ctx.Value(connKey{}).(*connMessage)
+		if !ok {
+			return nil, ErrSubscriptionsUnsupported
+		}
+		var args []string
+		if err := params.Decode(&args); err != nil || len(args) != 1 {
+			return nil, ErrInvalidParams
+		}
+		c := msg.conn
+		c.mu.Lock()
+		sub, ok := c.subscriptions[args[0]]
+		c.mu.Unlock()
+		if !ok || sub.method != namespace+subscriptionSuffix {
+			return nil, ErrSubscriptionNotFound
+		}
+		sub.close()
+		return true, nil
+	}
+}
+
+// Subscription is a subscription of a client, see Server.HandleSubscription.
+type Subscription struct {
+	ID string
+
+	conn   *serverConn
+	method string // method of the notifications
+
+	mu       sync.Mutex // serializes the notifications
+	active   bool
+	buffered [][]byte // notifications sent before the subscription was activated
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewSubscription returns a new subscription for the client of the request, to be
+// returned by a subscription handler. The values sent with Notify before the handler
+// returns are delivered after the response holding the id of the subscription.
+func NewSubscription(ctx context.Context) (*Subscription, error) {
+	call, ok := ctx.Value(subscribeKey{}).(*subscribeCall)
+	if !ok {
+		return nil, ErrSubscriptionsUnsupported
+	}
+	id, err := newSubscriptionID()
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{ID: id, conn: call.conn, method: call.method, done: make(chan struct{})}
+	c := call.conn
+	c.mu.Lock()
+	c.subscriptions[id] = sub
+	c.mu.Unlock()
+	call.created = append(call.created, sub)
+	return sub, nil
+}
+
+func newSubscriptionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("jsonrpc: generating subscription id: %w", err)
+	}
+	return "0x" + hex.EncodeToString(b), nil
+}
+
+// Notify sends v to the client, it blocks until the notification is written to the
+// connection. It returns ErrSubscriptionClosed once the client unsubscribed or disconnected.
+func (s *Subscription) Notify(v interface{}) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	msg := notificationMessage{Version: "2.0", Method: s.method, Params: subscriptionResult{ID: s.ID, Result: v}}
+	if err := s.conn.server.codec.NewEncoder(buf).Encode(msg); err != nil {
+		return fmt.Errorf("jsonrpc: encoding notification: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return ErrSubscriptionClosed
+	default:
+	}
+	if !s.active {
+		s.buffered = append(s.buffered, append([]byte(nil), buf.Bytes()...))
+		return nil
+	}
+	if err := s.conn.write(buf.Bytes()); err != nil {
+		return fmt.Errorf("jsonrpc: sending notification: %w", err)
+	}
+	return nil
+}
+
+// Done returns a channel that is closed when the client unsubscribes or disconnects.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// activate sends the buffered notifications, the next ones are sent directly.
+func (s *Subscription) activate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = true
+	select {
+	case <-s.done:
+		// the client unsubscribed before reading the response
+		s.buffered = nil
+		return
+	default:
+	}
+	for _, data := range s.buffered {
+		if s.conn.write(data) != nil {
+			break
+		}
+	}
+	s.buffered = nil
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() {
+		close(s.done)
+		c := s.conn
+		c.mu.Lock()
+		delete(c.subscriptions, s.ID)
+		c.mu.Unlock()
+	})
+}
+
+// closeSubscriptions closes the subscriptions of a connection that is closed.
+func (c *serverConn) closeSubscriptions() {
+	c.mu.Lock()
+	subs := make([]*Subscription, 0, len(c.subscriptions))
+	for _, sub := range c.subscriptions {
+		subs = append(subs, sub)
+	}
+	c.mu.Unlock()
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
+type subscriptionResult struct {
+	ID     string      `json:"subscription"`
+	Result interface{} `json:"result"`
+}
+
+// ClientSubscription is a subscription created with Client.Subscribe.
+type ClientSubscription struct {
+	client    *Client
+	namespace string
+	channel   reflect.Value
+	id        string // set when the response of the subscribe call is received
+	ended     bool   // set by close, guarded by the mutex of the connection with id
+
+	mu    sync.Mutex
+	queue []json.RawMessage
+	wake  chan struct{}
+	quit  chan struct{}
+	err   chan error
+	once  sync.Once
+}
+
+// Subscribe subscribes to a channel of the namespace, see Server.HandleSubscription. It
+// needs a Client created with NewConnClient or Dial. args holds the name of the channel
+// followed by its params, if any. The notifications are decoded into the element type of
+// channel, a Go channel, and sent to it in order until Unsubscribe is called or the
+// subscription fails; the error is then sent on Err. A subscription fails when the
+// connection is lost, or with ErrSubscriptionQueueOverflow when channel isn't read and
+// the notifications pile up.
+func (c *Client) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (*ClientSubscription, error) {
+	ch := reflect.ValueOf(channel)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.SendDir == 0 {
+		return nil, fmt.Errorf("jsonrpc: invalid channel type: expected writable chan, got %T", channel)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("jsonrpc: missing channel name")
+	}
+	if c.conn == nil {
+		return nil, ErrSubscriptionsUnsupported
+	}
+	p, err := c.codec.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("jsonrpc: marshaling params: %w", err)
+	}
+	sub := &ClientSubscription{
+		client:    c,
+		namespace: namespace,
+		channel:   ch,
+		wake:      make(chan struct{}, 1),
+		quit:      make(chan struct{}),
+		err:       make(chan error, 1),
+	}
+	resp, err := c.doCall(ctx, &request{ID: c.nextID(), Method: namespace + subscribeSuffix, Params: p, subscription: sub})
+	if err == nil {
+		err = resp.Err()
+	}
+	if err != nil {
+		// the server may have accepted the subscription before ctx was canceled
+		sub.Unsubscribe()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ID returns the id of the subscription.
+func (s *ClientSubscription) ID() string {
+	s.client.conn.mu.Lock()
+	defer s.client.conn.mu.Unlock()
+	return s.id
+}
+
+// Err returns a channel that receives the error that ended the subscription, it is
+// closed by Unsubscribe.
+func (s *ClientSubscription) Err() <-chan error {
+	return s.err
+}
+
+// Unsubscribe stops the delivery of the notifications and cancels the subscription on the server.
+func (s *ClientSubscription) Unsubscribe() {
+	s.end(nil)
+}
+
+// end ends the subscription with err and cancels it on the server.
+func (s *ClientSubscription) end(err error) {
+	if !s.close(err) {
+		return
+	}
+	if id := s.ID(); id != "" {
+		s.unsubscribe(id)
+	}
+}
+
+// unsubscribe cancels the subscription id on the server.
+func (s *ClientSubscription) unsubscribe(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+	defer cancel()
+	s.client.Call(ctx, s.namespace+unsubscribeSuffix, []string{id})
+}
+
+// close ends the subscription with err and reports whether it was still running.
+func (s *ClientSubscription) close(err error) bool {
+	closed := false
+	s.once.Do(func() {
+		closed = true
+		cc := s.client.conn
+		cc.mu.Lock()
+		s.ended = true
+		if cc.subscriptions[s.id] == s {
+			delete(cc.subscriptions, s.id)
+		}
+		cc.mu.Unlock()
+		close(s.quit)
+		if err != nil {
+			s.err <- err
+		}
+		close(s.err)
+	})
+	return closed
+}
+
+// deliver queues a notification, it is called by the reader of the connection and doesn't block.
+func (s *ClientSubscription) deliver(result json.RawMessage) {
+	s.mu.Lock()
+	if len(s.queue) >= maxSubscriptionQueue {
+		s.mu.Unlock()
+		go s.end(ErrSubscriptionQueueOverflow)
+		return
+	}
+	s.queue = append(s.queue, result)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// forward sends the queued notifications to the channel until the subscription ends.
+func (s *ClientSubscription) forward() {
+	etype := s.channel.Type().Elem()
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.quit:
+				return
+			}
+		}
+		result := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		v := reflect.New(etype)
+		if err := s.client.codec.Unmarshal(result, v.Interface()); err != nil {
+			go s.end(fmt.Errorf("jsonrpc: decoding notification: %w", err))
+			return
+		}
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: s.channel, Send: v.Elem()},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.quit)},
+		}
+		if chosen, _, _ := reflect.Select(cases); chosen == 1 {
+			return
+		}
+	}
+}
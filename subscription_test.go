@@ -0,0 +1,198 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type CountArgs struct {
+	From int
+}
+
+// newSubscriptionServer returns a server with a "test_count" channel that sends From, From+1, ...
+// and sends the subscriptions it creates on subs.
+func newSubscriptionServer(subs chan<- *Subscription) *Server {
+	server := NewServer()
+	server.HandleSubscription("test", "count", func(ctx context.Context, args CountArgs) (*Subscription, error) {
+		sub, err := NewSubscription(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// sent before the response, delivered after it
+		sub.Notify(args.From)
+		go func() {
+			for n := args.From + 1; sub.Notify(n) == nil; n++ {
+			}
+		}()
+		if subs != nil {
+			subs <- sub
+		}
+		return sub, nil
+	})
+	server.HandleSubscription("test", "none", func(ctx context.Context) (*Subscription, error) {
+		return NewSubscription(ctx)
+	})
+	server.HandleSubscription("test", "fail", func(ctx context.Context) (*Subscription, error) {
+		NewSubscription(ctx)
+		return nil, errors.New("fail")
+	})
+	return server
+}
+
+func TestSubscribe(t *testing.T) {
+	checkGoroutineLeaks(t)
+
+	subs := make(chan *Subscription, 1)
+	client := NewConnClient(serveConn(t, context.Background(), newSubscriptionServer(subs)))
+	defer client.Close()
+
+	ch := make(chan int)
+	sub, err := client.Subscribe(context.Background(), "test", ch, "count", CountArgs{From: 10})
+	if err != nil {
+		t.Fatalf("subscribe: error not expected: %v", err)
+	}
+	if !strings.HasPrefix(sub.ID(), "0x") {
+		t.Errorf("invalid subscription id %q", sub.ID())
+	}
+	for want := 10; want < 20; want++ {
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notification %v not received", want)
+		}
+	}
+
+	ssub := <-subs
+	sub.Unsubscribe()
+	select {
+	case <-ssub.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("subscription not closed on the server")
+	}
+	if _, ok := <-sub.Err(); ok {
+		t.Errorf("expected Err to be closed")
+	}
+	if err := ssub.Notify(1); err != ErrSubscriptionClosed {
+		t.Errorf("expected %v, got %v", ErrSubscriptionClosed, err)
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	client := NewConnClient(serveConn(t, context.Background(), newSubscriptionServer(nil)))
+	defer client.Close()
+
+	testcases := []struct {
+		name string
+		args []interface{}
+		err  error
+	}{
+		{name: "unknown_channel", args: []interface{}{"unknown"}, err: ErrMethodNotFound},
+		{name: "invalid_params", args: []interface{}{"count", "ten"}, err: ErrInvalidParams},
+		{name: "handler_error", args: []interface{}{"fail"}, err: ErrServerError},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.Subscribe(context.Background(), "test", make(chan int), tc.args...)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+
+	resp, err := client.Call(context.Background(), "test_unsubscribe", []string{"0x1"})
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if !errors.Is(resp.Err(), ErrSubscriptionNotFound) {
+		t.Errorf("expected %v, got %v", ErrSubscriptionNotFound, resp.Err())
+	}
+}
+
+func TestSubscribeHTTP(t *testing.T) {
+	ts := httptest.NewServer(newSubscriptionServer(nil))
+	defer ts.Close()
+	client := NewClient(ts.URL)
+
+	if _, err := client.Subscribe(context.Background(), "test", make(chan int), "none"); !errors.Is(err, ErrSubscriptionsUnsupported) {
+		t.Errorf("expected %v, got %v", ErrSubscriptionsUnsupported, err)
+	}
+	resp, err := client.Call(context.Background(), "test_subscribe", []string{"none"})
+	if err != nil {
+		t.Fatalf("error not expected: %v", err)
+	}
+	if !errors.Is(resp.Err(), ErrSubscriptionsUnsupported) {
+		t.Errorf("expected %v, got %v", ErrSubscriptionsUnsupported, resp.Err())
+	}
+}
+
+func TestSubscriptionConnClosed(t *testing.T) {
+	subs := make(chan *Subscription, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewConnClient(serveConn(t, ctx, newSubscriptionServer(subs)))
+	defer client.Close()
+
+	sub, err := client.Subscribe(context.Background(), "test", make(chan int), "count", CountArgs{From: 1})
+	if err != nil {
+		t.Fatalf("subscribe: error not expected: %v", err)
+	}
+	ssub := <-subs
+	cancel()
+	select {
+	case err := <-sub.Err():
+		if err != ErrConnClosed {
+			t.Errorf("expected %v, got %v", ErrConnClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("subscription not ended")
+	}
+	select {
+	case <-ssub.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("subscription not closed on the server")
+	}
+}
+
+func TestSubscribeCanceled(t *testing.T) {
+	// the handler blocks until its subscription is received, after the call was canceled
+	subs := make(chan *Subscription)
+	client := NewConnClient(serveConn(t, context.Background(), newSubscriptionServer(subs)))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Subscribe(ctx, "test", make(chan int), "count", CountArgs{From: 1}); err == nil {
+		t.Fatalf("subscribe: expected error")
+	}
+	ssub := <-subs
+	select {
+	case <-ssub.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("subscription accepted after the cancellation not closed on the server")
+	}
+}
+
+func TestSubscriptionNotifications(t *testing.T) {
+	conn := serveConn(t, context.Background(), newSubscriptionServer(nil))
+	r := bufio.NewReader(conn)
+	conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"test_subscribe","params":["count",{"From":7}]}` + "\n"))
+
+	// the response comes first, then the notifications
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, _ := r.ReadString('\n')
+	if !strings.HasPrefix(resp, `{"jsonrpc":"2.0","id":1,"result":"0x`) {
+		t.Fatalf("invalid response: %v", resp)
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(resp, `{"jsonrpc":"2.0","id":1,"result":"`), "\"}\n")
+	notification, _ := r.ReadString('\n')
+	if want := `{"jsonrpc":"2.0","method":"test_subscription","params":{"subscription":"` + id + `","result":7}}` + "\n"; notification != want {
+		t.Errorf("invalid notification: \ngot:  %v\nwant: %v", notification, want)
+	}
+}